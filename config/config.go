@@ -5,14 +5,47 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/cn-maul/Baize/domain"
 )
 
+// LoadOption 定义了加载配置时的可选项
+type LoadOption func(*loadOptions)
+
+// loadOptions 加载配置时的可选项
+type loadOptions struct {
+	discover       func(platform *domain.Platform) ([]string, error)
+	onDiscoverFail func(platform *domain.Platform, err error)
+}
+
+// WithModelDiscovery 在加载配置时通过discover发现各平台的可用模型，并合并到Platform.Models中
+// discover通常由provider.ModelDiscoverer创建；发现失败的平台保留配置文件中的模型列表
+func WithModelDiscovery(discover func(platform *domain.Platform) ([]string, error)) LoadOption {
+	return func(opts *loadOptions) {
+		opts.discover = discover
+	}
+}
+
+// WithDiscoveryErrorHandler 设置模型发现失败时的回调，每个发现失败的平台调用一次
+// 未设置时发现失败的平台静默保留配置文件中的模型列表；配置文件中没有模型的平台发现失败时LoadConfig返回错误
+func WithDiscoveryErrorHandler(handler func(platform *domain.Platform, err error)) LoadOption {
+	return func(opts *loadOptions) {
+		opts.onDiscoverFail = handler
+	}
+}
+
 // LoadConfig 加载并解析配置文件
-func LoadConfig(configPath string) (*domain.Config, error) {
+func LoadConfig(configPath string, options ...LoadOption) (*domain.Config, error) {
+	// 应用可选项
+	opts := &loadOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
 	// 确保配置文件路径是绝对路径
 	absPath, err := filepath.Abs(configPath)
 	if err != nil {
@@ -36,6 +69,25 @@ func LoadConfig(configPath string) (*domain.Config, error) {
 		return nil, fmt.Errorf("无法解析配置文件: %w", err)
 	}
 
+	// 发现并合并模型，发现前先验证平台配置，避免向无效的平台发送请求
+	if opts.discover != nil {
+		for name, platform := range config.Platforms {
+			if err := validatePlatform(name, platform); err != nil {
+				return nil, err
+			}
+		}
+		errs := discoverModels(&config, opts.discover)
+		for name, err := range errs {
+			platform := config.Platforms[name]
+			if opts.onDiscoverFail != nil {
+				opts.onDiscoverFail(platform, err)
+			}
+			if len(platform.Models) == 0 {
+				return nil, fmt.Errorf("平台 %s 没有定义模型，且模型发现失败: %w", name, err)
+			}
+		}
+	}
+
 	// 验证配置有效性
 	if err := validateConfig(&config); err != nil {
 		return nil, err
@@ -44,6 +96,45 @@ func LoadConfig(configPath string) (*domain.Config, error) {
 	return &config, nil
 }
 
+// discoverModels 并发发现各平台的模型，并将新发现的模型追加到配置的模型列表之后
+// 返回发现失败的平台及其错误，键与config.Platforms相同
+func discoverModels(config *domain.Config, discover func(platform *domain.Platform) ([]string, error)) map[string]error {
+	var mu sync.Mutex
+	errs := make(map[string]error)
+	var wg sync.WaitGroup
+	for name, platform := range config.Platforms {
+		wg.Add(1)
+		go func(name string, platform *domain.Platform) {
+			defer wg.Done()
+			models, err := discover(platform)
+			if err != nil {
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+				return
+			}
+			platform.Models = mergeModels(platform.Models, models)
+		}(name, platform)
+	}
+	wg.Wait()
+	return errs
+}
+
+// mergeModels 合并模型列表，保留原有顺序和元数据并去除重复项
+func mergeModels(existing []domain.Model, discovered []string) []domain.Model {
+	seen := make(map[string]bool, len(existing))
+	for _, m := range existing {
+		seen[m.Name] = true
+	}
+	for _, name := range discovered {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			existing = append(existing, domain.Model{Name: name})
+		}
+	}
+	return existing
+}
+
 // validateConfig 验证配置有效性
 func validateConfig(config *domain.Config) error {
 	// 检查版本
@@ -58,39 +149,168 @@ func validateConfig(config *domain.Config) error {
 
 	// 检查每个平台的有效性
 	for name, platform := range config.Platforms {
-		if platform.ID == "" {
-			return fmt.Errorf("平台 %s 缺少ID", name)
+		if err := validatePlatform(name, platform); err != nil {
+			return err
 		}
-		if platform.Name == "" {
-			return fmt.Errorf("平台 %s 缺少名称", name)
+		if len(platform.Models) == 0 {
+			return fmt.Errorf("平台 %s 没有定义模型", name)
 		}
-		if platform.Type == "" {
-			return fmt.Errorf("平台 %s 缺少类型", name)
+		for i, model := range platform.Models {
+			if model.Name == "" {
+				return fmt.Errorf("平台 %s 的第%d个模型缺少名称", name, i+1)
+			}
+			if model.MaxOutputTokens < 0 || model.ContextWindow < 0 {
+				return fmt.Errorf("平台 %s 的模型 %s 的token限制不能为负数", name, model.Name)
+			}
 		}
-		if platform.BaseURL == "" {
-			return fmt.Errorf("平台 %s 缺少基础URL", name)
+	}
+
+	// 检查模型别名是否都能解析
+	for alias := range config.Aliases {
+		if _, _, err := ResolveModel(config, alias); err != nil {
+			return err
 		}
-		if platform.APIKey == "" {
-			return fmt.Errorf("平台 %s 缺少API Key", name)
+	}
+
+	// 检查路由目标是否都能解析
+	for name, route := range config.Routes {
+		if route == nil || len(route.Targets) == 0 {
+			return fmt.Errorf("路由 %s 没有定义目标", name)
 		}
-		if len(platform.Models) == 0 {
-			return fmt.Errorf("平台 %s 没有定义模型", name)
+		for _, target := range route.Targets {
+			if _, _, err := ResolveModel(config, target); err != nil {
+				return fmt.Errorf("路由 %s 的目标 %s 无效: %w", name, target, err)
+			}
+		}
+		for ref, weight := range route.Weights {
+			if !slices.Contains(route.Targets, ref) {
+				return fmt.Errorf("路由 %s 的权重引用了不存在的目标 %s", name, ref)
+			}
+			if weight < 0 {
+				return fmt.Errorf("路由 %s 的目标 %s 权重不能为负数", name, ref)
+			}
 		}
+	}
 
-		// 检查BaseURL格式
-		if _, err := url.Parse(platform.BaseURL); err != nil {
-			return fmt.Errorf("平台 %s 的BaseURL格式无效: %w", name, err)
+	// 检查路由规则
+	for i, rule := range config.Rules {
+		if rule == nil {
+			return fmt.Errorf("第%d条路由规则为空", i+1)
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
 		}
+		if rule.Target == "" {
+			return fmt.Errorf("路由规则 %s 缺少目标", name)
+		}
+		if _, ok := config.Routes[rule.Target]; !ok {
+			if _, err := ResolveModelCandidates(config, rule.Target); err != nil {
+				return fmt.Errorf("路由规则 %s 的目标 %s 无效: %w", name, rule.Target, err)
+			}
+		}
+		for _, contentType := range rule.Match.ContentTypes {
+			switch contentType {
+			case domain.ContentTypeText, domain.ContentTypeImage, domain.ContentTypeDocument:
+			default:
+				return fmt.Errorf("路由规则 %s 的内容类型 %s 不支持", name, contentType)
+			}
+		}
+		if rule.Match.MinPromptTokens < 0 || rule.Match.MaxPromptTokens < 0 {
+			return fmt.Errorf("路由规则 %s 的token数条件不能为负数", name)
+		}
+	}
+
+	return nil
+}
+
+// validatePlatform 验证单个平台的连接和限流等配置，不检查模型列表
+func validatePlatform(name string, platform *domain.Platform) error {
+	if platform == nil {
+		return fmt.Errorf("平台 %s 的配置为空", name)
+	}
+	if platform.ID == "" {
+		return fmt.Errorf("平台 %s 缺少ID", name)
+	}
+	if platform.Name == "" {
+		return fmt.Errorf("平台 %s 缺少名称", name)
+	}
+	if platform.Type == "" {
+		return fmt.Errorf("平台 %s 缺少类型", name)
+	}
+	if platform.BaseURL == "" {
+		return fmt.Errorf("平台 %s 缺少基础URL", name)
+	}
+	if len(platform.Keys()) == 0 {
+		return fmt.Errorf("平台 %s 缺少API Key", name)
+	}
+
+	// 检查BaseURL格式
+	if _, err := url.Parse(platform.BaseURL); err != nil {
+		return fmt.Errorf("平台 %s 的BaseURL格式无效: %w", name, err)
+	}
 
-		// 检查API Key长度
-		if len(platform.APIKey) < 10 {
+	// 检查API Key长度
+	for _, key := range platform.Keys() {
+		if len(key) < 10 {
 			return fmt.Errorf("平台 %s 的API Key长度不足", name)
 		}
+	}
 
-		// 检查平台类型是否支持
-		if platform.Type != "openai" && platform.Type != "anthropic" {
-			return fmt.Errorf("平台 %s 的类型 %s 不支持", name, platform.Type)
+	// 检查熔断器配置
+	if cb := platform.CircuitBreaker; cb != nil {
+		if cb.FailureRate < 0 || cb.FailureRate > 1 {
+			return fmt.Errorf("平台 %s 的熔断失败率阈值必须在0到1之间", name)
 		}
+		if cb.ConsecutiveFailures < 0 || cb.MinRequests < 0 || cb.HalfOpenRequests < 0 || cb.Window < 0 || cb.CoolDown < 0 {
+			return fmt.Errorf("平台 %s 的熔断器配置不能为负数", name)
+		}
+	}
+
+	// 检查限流配置
+	if rl := platform.RateLimit; rl != nil {
+		if rl.RPM < 0 || rl.TPM < 0 {
+			return fmt.Errorf("平台 %s 的限流配置不能为负数", name)
+		}
+		switch rl.Scope {
+		case "", domain.RateLimitScopePlatform, domain.RateLimitScopeModel, domain.RateLimitScopeKey:
+		default:
+			return fmt.Errorf("平台 %s 的限流范围 %s 不支持", name, rl.Scope)
+		}
+	}
+
+	// 检查并发限制配置
+	if cc := platform.Concurrency; cc != nil {
+		if cc.MaxInFlight < 1 {
+			return fmt.Errorf("平台 %s 的最大并发数必须大于0", name)
+		}
+		if cc.MaxQueue < 0 {
+			return fmt.Errorf("平台 %s 的最大排队数不能为负数", name)
+		}
+	}
+
+	// 检查健康检查配置
+	if hc := platform.HealthCheck; hc != nil {
+		if hc.Interval < 0 || hc.Timeout < 0 || hc.DegradedLatency < 0 || hc.FailureThreshold < 0 {
+			return fmt.Errorf("平台 %s 的健康检查配置不能为负数", name)
+		}
+		switch hc.Probe {
+		case "", domain.HealthProbeModels, domain.HealthProbeChat:
+		default:
+			return fmt.Errorf("平台 %s 的健康检查探测方式 %s 不支持", name, hc.Probe)
+		}
+	}
+
+	// 检查Key选择策略
+	switch platform.KeySelection {
+	case "", "round_robin", "least_throttled":
+	default:
+		return fmt.Errorf("平台 %s 的Key选择策略 %s 不支持", name, platform.KeySelection)
+	}
+
+	// 检查平台类型是否支持
+	if platform.Type != "openai" && platform.Type != "anthropic" {
+		return fmt.Errorf("平台 %s 的类型 %s 不支持", name, platform.Type)
 	}
 
 	return nil
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+func TestMergeModels(t *testing.T) {
+	existing := []domain.Model{{Name: "a", ContextWindow: 128000}, {Name: "b"}}
+	merged := mergeModels(existing, []string{"b", "c", "", "c", "a", "d"})
+
+	// 保留配置中的顺序和元数据，新发现的模型按发现顺序追加且不重复
+	want := []domain.Model{{Name: "a", ContextWindow: 128000}, {Name: "b"}, {Name: "c"}, {Name: "d"}}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("合并结果为%+v，期望%+v", merged, want)
+	}
+}
+
+// writeConfig 将YAML写入临时配置文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	return path
+}
+
+const discoveryConfig = `
+version: "1.0"
+platforms:
+  configured:
+    id: "configured"
+    name: "已配置模型的平台"
+    type: "openai"
+    base_url: "https://configured.example.com/v1"
+    api_key: "sk-configured-key"
+    models:
+      - "m1"
+  empty:
+    id: "empty"
+    name: "未配置模型的平台"
+    type: "openai"
+    base_url: "https://empty.example.com/v1"
+    api_key: "sk-empty-key-123"
+`
+
+func TestLoadConfigDiscovery(t *testing.T) {
+	path := writeConfig(t, discoveryConfig)
+	cfg, err := LoadConfig(path, WithModelDiscovery(func(platform *domain.Platform) ([]string, error) {
+		return []string{"m1", platform.ID + "-discovered"}, nil
+	}))
+	if err != nil {
+		t.Fatalf("LoadConfig失败: %v", err)
+	}
+	if got := cfg.Platforms["configured"].Models; !reflect.DeepEqual(got, []domain.Model{{Name: "m1"}, {Name: "configured-discovered"}}) {
+		t.Errorf("configured的模型为%+v", got)
+	}
+	if got := cfg.Platforms["empty"].Models; !reflect.DeepEqual(got, []domain.Model{{Name: "m1"}, {Name: "empty-discovered"}}) {
+		t.Errorf("empty的模型为%+v", got)
+	}
+}
+
+func TestLoadConfigDiscoveryFailure(t *testing.T) {
+	errDiscover := errors.New("连接被拒绝")
+	var mu sync.Mutex
+	var failed []string
+	onFail := WithDiscoveryErrorHandler(func(platform *domain.Platform, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !errors.Is(err, errDiscover) {
+			t.Errorf("回调收到的错误为%v", err)
+		}
+		failed = append(failed, platform.ID)
+	})
+
+	// 已配置模型的平台发现失败时保留配置中的模型
+	path := writeConfig(t, discoveryConfig)
+	cfg, err := LoadConfig(path, onFail, WithModelDiscovery(func(platform *domain.Platform) ([]string, error) {
+		if platform.ID == "configured" {
+			return nil, errDiscover
+		}
+		return []string{"m2"}, nil
+	}))
+	if err != nil {
+		t.Fatalf("LoadConfig失败: %v", err)
+	}
+	if got := cfg.Platforms["configured"].Models; !reflect.DeepEqual(got, []domain.Model{{Name: "m1"}}) {
+		t.Errorf("发现失败后configured的模型为%+v，期望保留配置中的模型", got)
+	}
+	if !reflect.DeepEqual(failed, []string{"configured"}) {
+		t.Errorf("发现失败回调的平台为%v，期望[configured]", failed)
+	}
+
+	// 未配置模型的平台发现失败时返回错误
+	failed = nil
+	_, err = LoadConfig(path, onFail, WithModelDiscovery(func(platform *domain.Platform) ([]string, error) {
+		if platform.ID == "empty" {
+			return nil, errDiscover
+		}
+		return nil, nil
+	}))
+	if !errors.Is(err, errDiscover) || !strings.Contains(err.Error(), "平台 empty 没有定义模型，且模型发现失败") {
+		t.Fatalf("LoadConfig返回%v，期望说明平台empty的模型发现失败", err)
+	}
+	if !reflect.DeepEqual(failed, []string{"empty"}) {
+		t.Errorf("发现失败回调的平台为%v，期望[empty]", failed)
+	}
+}
+
+func TestLoadConfigDiscoveryValidatesPlatforms(t *testing.T) {
+	path := writeConfig(t, `
+version: "1.0"
+platforms:
+  broken:
+    id: "broken"
+    name: "缺少API Key的平台"
+    type: "openai"
+    base_url: "https://broken.example.com/v1"
+`)
+	called := false
+	_, err := LoadConfig(path, WithModelDiscovery(func(platform *domain.Platform) ([]string, error) {
+		called = true
+		return nil, nil
+	}))
+	if err == nil || !strings.Contains(err.Error(), "平台 broken 缺少API Key") {
+		t.Fatalf("LoadConfig返回%v，期望平台配置校验错误", err)
+	}
+	if called {
+		t.Error("无效的平台仍然进行了模型发现")
+	}
+}
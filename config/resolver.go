@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+var (
+	// ErrModelNotFound 没有平台提供所引用的模型
+	ErrModelNotFound = errors.New("未找到模型")
+	// ErrAmbiguousModel 引用的模型由多个平台提供，需要使用"平台ID/模型"的形式指定
+	ErrAmbiguousModel = errors.New("模型引用不明确")
+)
+
+// ModelCandidate 提供模型的平台和实际模型名称
+type ModelCandidate struct {
+	Platform *domain.Platform
+	Model    string
+}
+
+// ResolveModel 将模型引用解析为提供该模型的平台和实际模型名称
+// 引用按以下顺序解析：
+//  1. 配置文件aliases中定义的别名，其目标按第2、3条解析
+//  2. "平台ID/模型"形式的引用，平台ID可以是map键或平台的ID字段，模型可以是名称或别名
+//  3. 模型名称或模型的alias，在所有平台中查找，多个平台匹配时返回ErrAmbiguousModel
+//
+// 由于模型名称本身可能包含"/"（如deepseek-ai/DeepSeek-V3.2），前缀不是平台ID时按第3条解析
+func ResolveModel(config *domain.Config, ref string) (*domain.Platform, string, error) {
+	candidates, err := ResolveModelCandidates(config, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(candidates) > 1 {
+		names := make([]string, 0, len(candidates))
+		for _, c := range candidates {
+			names = append(names, c.Platform.ID+"/"+c.Model)
+		}
+		return nil, "", fmt.Errorf("%w: %s，可选: %s", ErrAmbiguousModel, ref, strings.Join(names, ", "))
+	}
+	return candidates[0].Platform, candidates[0].Model, nil
+}
+
+// ResolveModelCandidates 与ResolveModel的解析规则相同，但按第3条解析时返回所有提供该模型的平台，
+// 按平台的map键排序；没有平台提供该模型时返回ErrModelNotFound
+func ResolveModelCandidates(config *domain.Config, ref string) ([]ModelCandidate, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("模型引用不能为空")
+	}
+	if target, ok := config.Aliases[ref]; ok {
+		candidates, err := resolveReference(config, target)
+		if err != nil {
+			return nil, fmt.Errorf("别名 %s 指向的模型 %s 无效: %w", ref, target, err)
+		}
+		return candidates, nil
+	}
+	return resolveReference(config, ref)
+}
+
+// resolveReference 解析"平台ID/模型"形式的引用或模型名称、模型别名
+func resolveReference(config *domain.Config, ref string) ([]ModelCandidate, error) {
+	if platformID, name, ok := strings.Cut(ref, "/"); ok {
+		if platform, err := GetPlatformByID(config, platformID); err == nil {
+			if model := findModel(platform, name); model != nil {
+				return []ModelCandidate{{Platform: platform, Model: model.Name}}, nil
+			}
+		}
+	}
+
+	var candidates []ModelCandidate
+	seen := make(map[*domain.Platform]bool)
+	for _, platform := range sortedPlatforms(config) {
+		if seen[platform] {
+			continue
+		}
+		seen[platform] = true
+		if model := findModel(platform, ref); model != nil {
+			candidates = append(candidates, ModelCandidate{Platform: platform, Model: model.Name})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, ref)
+	}
+	return candidates, nil
+}
+
+// findModel 按名称或别名查找平台的模型，名称优先
+func findModel(platform *domain.Platform, ref string) *domain.Model {
+	if model := platform.FindModel(ref); model != nil {
+		return model
+	}
+	for i := range platform.Models {
+		if platform.Models[i].Alias == ref {
+			return &platform.Models[i]
+		}
+	}
+	return nil
+}
+
+// sortedPlatforms 按map键排序返回平台，保证解析结果和错误信息稳定
+func sortedPlatforms(config *domain.Config) []*domain.Platform {
+	keys := make([]string, 0, len(config.Platforms))
+	for key, platform := range config.Platforms {
+		if platform != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	platforms := make([]*domain.Platform, 0, len(keys))
+	for _, key := range keys {
+		platforms = append(platforms, config.Platforms[key])
+	}
+	return platforms
+}
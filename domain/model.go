@@ -1,23 +1,225 @@
 package domain
 
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 // Config 配置结构体，映射整个YAML文件
 type Config struct {
-	Version   string                 `yaml:"version"`
+	Version   string               `yaml:"version"`
 	Platforms map[string]*Platform `yaml:"platforms"`
+	Aliases   map[string]string    `yaml:"aliases"` // 模型别名，值为"平台ID/模型"或模型名称
+	Routes    map[string]*Route    `yaml:"routes"`  // 路由，将逻辑模型映射到按顺序尝试的多个目标
+	Rules     []*Rule              `yaml:"rules"`   // 路由规则，按顺序匹配请求，第一条匹配的规则决定请求的目标
+}
+
+// 规则可匹配的内容类型
+const (
+	ContentTypeText     = "text"
+	ContentTypeImage    = "image"
+	ContentTypeDocument = "document"
+)
+
+// Rule 路由规则，请求满足Match中的所有条件时发往Target
+type Rule struct {
+	Name   string    `yaml:"name"`
+	Match  RuleMatch `yaml:"match"`
+	Target string    `yaml:"target"` // 路由名称或模型引用，格式同aliases的值
+}
+
+// RuleMatch 规则的匹配条件，零值条件不参与匹配
+type RuleMatch struct {
+	Models          []string          `yaml:"models"`            // 请求的模型（或别名、路由名）属于其中之一
+	MinPromptTokens int               `yaml:"min_prompt_tokens"` // 估算的输入token数不少于该值
+	MaxPromptTokens int               `yaml:"max_prompt_tokens"` // 估算的输入token数不超过该值
+	ContentTypes    []string          `yaml:"content_types"`     // 请求包含所有列出的内容类型：text、image、document
+	Tags            []string          `yaml:"tags"`              // 请求包含所有列出的标签
+	Metadata        map[string]string `yaml:"metadata"`          // 请求元数据包含所有列出的键值
+}
+
+// Route 路由配置，定义逻辑模型的回退链
+type Route struct {
+	Targets []string       `yaml:"targets"` // 目标模型引用，按顺序尝试，格式同aliases的值
+	Balance string         `yaml:"balance"` // 负载均衡策略，为空时按配置顺序尝试
+	Weights map[string]int `yaml:"weights"` // 目标权重，键为targets中的引用，未配置的目标权重为1，用于weighted策略
+	Hedge   *HedgeConfig   `yaml:"hedge"`   // 对冲请求配置，nil表示使用Router的默认配置
+}
+
+// HedgeConfig 对冲请求配置
+// 当前目标在Delay内没有产生第一个内容事件（文本、推理或工具调用；非流式请求为完整响应）时，向下一个目标发送同样的请求，采用最先响应的结果
+type HedgeConfig struct {
+	Delay       time.Duration `yaml:"delay"`        // 发送下一个对冲请求前的等待时间，0表示不对冲
+	MaxParallel int           `yaml:"max_parallel"` // 同时进行的最大请求数，默认2
+}
+
+// UnmarshalYAML 支持直接以列表形式配置路由目标
+func (r *Route) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		*r = Route{}
+		return value.Decode(&r.Targets)
+	}
+
+	type plain Route
+	return value.Decode((*plain)(r))
 }
 
 // Platform 平台结构体，包含平台的基本信息
 type Platform struct {
-	ID      string   `yaml:"id"`
-	Name    string   `yaml:"name"`
-	Type    string   `yaml:"type"`
-	BaseURL string   `yaml:"base_url"`
-	APIKey  string   `yaml:"api_key"`
-	Models  []string `yaml:"models"`
+	ID           string   `yaml:"id"`
+	Name         string   `yaml:"name"`
+	Type         string   `yaml:"type"`
+	BaseURL      string   `yaml:"base_url"`
+	APIKey       string   `yaml:"api_key"`
+	APIKeys      []string `yaml:"api_keys"`      // 额外的API Key，与api_key一起组成Key池
+	KeySelection string   `yaml:"key_selection"` // Key选择策略：round_robin（默认）或least_throttled
+	Models       []Model  `yaml:"models"`        // 可用模型，配置中既可以是字符串也可以是对象
+	Capabilities []string `yaml:"capabilities"`  // 平台声明的额外能力，如rerank
+
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker"` // 熔断器配置，nil表示不启用
+	RateLimit      *RateLimitConfig      `yaml:"rate_limit"`      // 客户端限流配置，nil表示不限流
+	Concurrency    *ConcurrencyConfig    `yaml:"concurrency"`     // 并发限制配置，nil表示不限制
+	HealthCheck    *HealthCheckConfig    `yaml:"health_check"`    // 健康检查配置，nil表示使用Router的默认配置
 }
 
-// Model 模型结构体，定义模型的基本信息
+// 健康检查的探测方式
+const (
+	HealthProbeModels = "models" // 请求平台的模型列表接口，探测结果适用于平台的所有模型
+	HealthProbeChat   = "chat"   // 向每个模型发送只生成1个token的对话请求
+)
+
+// HealthCheckConfig 主动健康检查配置
+type HealthCheckConfig struct {
+	Interval         time.Duration `yaml:"interval"`          // 探测间隔，默认30s
+	Timeout          time.Duration `yaml:"timeout"`           // 单次探测的超时时间，默认10s
+	Probe            string        `yaml:"probe"`             // 探测方式：models（默认）或chat
+	DegradedLatency  time.Duration `yaml:"degraded_latency"`  // 探测耗时超过该值时视为降级，0表示不按耗时判断
+	FailureThreshold int           `yaml:"failure_threshold"` // 连续失败多少次后视为不可用，默认2
+}
+
+// ConcurrencyConfig 并发限制配置
+type ConcurrencyConfig struct {
+	MaxInFlight int `yaml:"max_in_flight"` // 同时进行的最大请求数
+	MaxQueue    int `yaml:"max_queue"`     // 最大排队请求数，0表示不限制
+}
+
+// 限流的作用范围
+const (
+	// RateLimitScopePlatform 整个平台共享配额
+	RateLimitScopePlatform = "platform"
+	// RateLimitScopeModel 每个模型单独计算配额
+	RateLimitScopeModel = "model"
+	// RateLimitScopeKey 每个API Key单独计算配额
+	RateLimitScopeKey = "key"
+)
+
+// RateLimitConfig 客户端限流配置，零值表示对应维度不限流
+type RateLimitConfig struct {
+	RPM   int    `yaml:"rpm"`   // 每分钟请求数
+	TPM   int    `yaml:"tpm"`   // 每分钟token数（按请求估算，包含max_tokens）
+	Scope string `yaml:"scope"` // 作用范围：platform（默认）、model或key
+}
+
+// CircuitBreakerConfig 熔断器配置，零值字段使用默认值
+type CircuitBreakerConfig struct {
+	ConsecutiveFailures int           `yaml:"consecutive_failures"` // 连续失败多少次后熔断，默认5
+	FailureRate         float64       `yaml:"failure_rate"`         // 统计窗口内失败率达到该值后熔断（0~1），0表示不按失败率熔断
+	MinRequests         int           `yaml:"min_requests"`         // 按失败率熔断所需的最少请求数，默认20
+	Window              time.Duration `yaml:"window"`               // 失败率统计窗口，默认60s
+	CoolDown            time.Duration `yaml:"cool_down"`            // 熔断后进入半开状态前的等待时间，默认30s
+	HalfOpenRequests    int           `yaml:"half_open_requests"`   // 半开状态允许的探测请求数，全部成功后恢复，默认1
+}
+
+// 平台能力
+const (
+	// CapabilityRerank 平台提供/rerank接口
+	CapabilityRerank = "rerank"
+)
+
+// HasCapability 判断平台是否声明了指定能力
+func (p *Platform) HasCapability(capability string) bool {
+	for _, c := range p.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys 返回平台的所有API Key，api_key在前，去除空值和重复项
+func (p *Platform) Keys() []string {
+	keys := make([]string, 0, 1+len(p.APIKeys))
+	seen := make(map[string]bool, cap(keys))
+	for _, key := range append([]string{p.APIKey}, p.APIKeys...) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ModelNames 返回平台所有模型的名称
+func (p *Platform) ModelNames() []string {
+	names := make([]string, 0, len(p.Models))
+	for _, m := range p.Models {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// FindModel 根据模型名称查找模型元数据，未找到时返回nil
+func (p *Platform) FindModel(name string) *Model {
+	for i := range p.Models {
+		if p.Models[i].Name == name {
+			return &p.Models[i]
+		}
+	}
+	return nil
+}
+
+// Model 模型结构体，定义模型的基本信息和元数据
 type Model struct {
-	Name  string `yaml:"name"`
-	Alias string `yaml:"alias"`
+	Name            string             `yaml:"name"`
+	Alias           string             `yaml:"alias"`
+	ContextWindow   int                `yaml:"context_window"`    // 上下文窗口大小（token）
+	MaxOutputTokens int                `yaml:"max_output_tokens"` // 最大输出token数
+	Defaults        ModelDefaults      `yaml:"defaults"`          // 请求未指定时使用的默认生成参数
+	Capabilities    *ModelCapabilities `yaml:"capabilities"`      // 模型能力，nil表示未知，不做校验
+	Pricing         *ModelPricing      `yaml:"pricing"`           // 价格，nil表示未知
+}
+
+// ModelDefaults 模型的默认生成参数
+type ModelDefaults struct {
+	Temperature *float64 `yaml:"temperature"`
+	TopP        *float64 `yaml:"top_p"`
+	MaxTokens   int      `yaml:"max_tokens"`
+}
+
+// ModelCapabilities 模型能力
+type ModelCapabilities struct {
+	Vision     bool `yaml:"vision"`     // 支持图片输入
+	Tools      bool `yaml:"tools"`      // 支持工具调用
+	Reasoning  bool `yaml:"reasoning"`  // 支持推理（思考）输出
+	Embeddings bool `yaml:"embeddings"` // 向量化模型
+}
+
+// ModelPricing 模型价格，单位为每百万token
+type ModelPricing struct {
+	Input       float64 `yaml:"input"`        // 输入价格
+	Output      float64 `yaml:"output"`       // 输出价格
+	CachedInput float64 `yaml:"cached_input"` // 缓存命中的输入价格
+	Currency    string  `yaml:"currency"`     // 币种，如CNY、USD
+}
+
+// UnmarshalYAML 支持字符串和对象两种格式的模型配置
+func (m *Model) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*m = Model{}
+		return value.Decode(&m.Name)
+	}
+
+	type plain Model
+	return value.Decode((*plain)(m))
 }
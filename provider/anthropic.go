@@ -2,10 +2,14 @@ package provider
 
 import (
 	"bufio"
+	"cmp"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/cn-maul/Baize/domain"
@@ -18,261 +22,698 @@ type AnthropicProvider struct {
 
 // NewAnthropicProvider 创建新的AnthropicProvider实例
 func NewAnthropicProvider(platform *domain.Platform, options ...ProviderOption) (AIProvider, error) {
+	base := NewBaseProvider(platform.BaseURL, platform.APIKey, options...)
+	base.providerType = "anthropic"
+	base.setPlatform(platform)
+	base.authorize = func(header http.Header, key string) {
+		header.Set("x-api-key", key)
+	}
 	return &AnthropicProvider{
-		BaseProvider: NewBaseProvider(platform.BaseURL, platform.APIKey, options...),
+		BaseProvider: base,
 	}, nil
 }
 
+// defaultAnthropicMaxTokens 请求未指定MaxTokens时使用的默认值（Anthropic接口要求必填）
+const defaultAnthropicMaxTokens = 1000
+
 // AnthropicRequest Anthropic API请求结构
 type AnthropicRequest struct {
-	Model     string    `json:"model"`
-	Messages  []Message `json:"messages"`
-	MaxTokens int       `json:"max_tokens"`
-	Stream    bool      `json:"stream,omitempty"`
+	Model         string               `json:"model"`
+	System        []ContentBlock       `json:"system,omitempty"`
+	Messages      []AnthropicMessage   `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Stream        bool                 `json:"stream,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Tools         []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *AnthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+// AnthropicMessage Anthropic API消息结构，内容统一使用内容块数组表示
+type AnthropicMessage struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// AnthropicTool Anthropic API工具定义
+type AnthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// AnthropicToolChoice Anthropic API工具选择策略
+type AnthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 // AnthropicResponse Anthropic API响应结构
 type AnthropicResponse struct {
-	Content []ContentBlock `json:"content"`
-	Error   *Error         `json:"error,omitempty"`
+	ID         string          `json:"id"`
+	Model      string          `json:"model"`
+	Content    []ContentBlock  `json:"content"`
+	StopReason string          `json:"stop_reason,omitempty"`
+	Usage      *AnthropicUsage `json:"usage,omitempty"`
+	Error      *Error          `json:"error,omitempty"`
+}
+
+// AnthropicUsage Anthropic API用量结构
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// toUsage 将Anthropic用量转换为归一化的Usage
+// Anthropic的input_tokens不包含缓存部分，这里将其合并以与OpenAI口径保持一致
+func (u *AnthropicUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{
+		InputTokens:  u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		OutputTokens: u.OutputTokens,
+		CachedTokens: u.CacheReadInputTokens,
+	}
+}
+
+// merge 合并流式事件中的用量，message_delta中的output_tokens为累计值
+func (u *AnthropicUsage) merge(other *AnthropicUsage) {
+	if other == nil {
+		return
+	}
+	if other.InputTokens > 0 {
+		u.InputTokens = other.InputTokens
+	}
+	if other.CacheCreationInputTokens > 0 {
+		u.CacheCreationInputTokens = other.CacheCreationInputTokens
+	}
+	if other.CacheReadInputTokens > 0 {
+		u.CacheReadInputTokens = other.CacheReadInputTokens
+	}
+	if other.OutputTokens > 0 {
+		u.OutputTokens = other.OutputTokens
+	}
 }
 
 // AnthropicStreamResponse Anthropic API流式响应结构
 type AnthropicStreamResponse struct {
-	Type    string         `json:"type"`
-	Message *StreamMessage `json:"message,omitempty"`
-	Error   *Error         `json:"error,omitempty"`
+	Type         string          `json:"type"`
+	Index        int             `json:"index"`
+	Message      *StreamMessage  `json:"message,omitempty"`
+	ContentBlock *ContentBlock   `json:"content_block,omitempty"`
+	Delta        *AnthropicDelta `json:"delta,omitempty"`
+	Usage        *AnthropicUsage `json:"usage,omitempty"`
+	Error        *Error          `json:"error,omitempty"`
 }
 
 // StreamMessage 流式消息结构
 type StreamMessage struct {
-	ID         string         `json:"id"`
-	Type       string         `json:"type"`
-	Role       string         `json:"role"`
-	Content    []ContentBlock `json:"content"`
-	StopReason string         `json:"stop_reason,omitempty"`
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Role       string          `json:"role"`
+	Model      string          `json:"model"`
+	Content    []ContentBlock  `json:"content"`
+	StopReason string          `json:"stop_reason,omitempty"`
+	Usage      *AnthropicUsage `json:"usage,omitempty"`
 }
 
 // ContentBlock 内容块结构
 type ContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	ID        string           `json:"id,omitempty"`          // tool_use块的调用ID
+	Name      string           `json:"name,omitempty"`        // tool_use块的工具名称
+	Input     json.RawMessage  `json:"input,omitempty"`       // tool_use块的调用参数
+	ToolUseID string           `json:"tool_use_id,omitempty"` // tool_result块对应的调用ID
+	Content   string           `json:"content,omitempty"`     // tool_result块的结果内容
+	Source    *AnthropicSource `json:"source,omitempty"`      // image/document块的数据来源
+	Thinking  string           `json:"thinking,omitempty"`    // thinking块的思考内容
+	Signature string           `json:"signature,omitempty"`   // thinking块的签名
 }
 
-// Chat 实现AIProvider接口的Chat方法
-func (p *AnthropicProvider) Chat(ctx context.Context, model string, msg string) (string, error) {
-	// 构建请求体
+// AnthropicSource Anthropic API图片/文档块的数据来源
+type AnthropicSource struct {
+	Type      string `json:"type"` // base64 或 url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicDelta 流式响应中的增量结构
+// content_block_delta事件的Type为text_delta、thinking_delta、signature_delta或input_json_delta，
+// message_delta事件的增量不带Type，仅包含StopReason和StopSequence
+type AnthropicDelta struct {
+	Type         string `json:"type,omitempty"`
+	Text         string `json:"text,omitempty"`
+	Thinking     string `json:"thinking,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+	PartialJSON  string `json:"partial_json,omitempty"`
+	StopReason   string `json:"stop_reason,omitempty"`
+	StopSequence string `json:"stop_sequence,omitempty"`
+}
+
+// newAnthropicRequest 将统一的ChatRequest映射为Anthropic请求体
+func (p *AnthropicProvider) newAnthropicRequest(req *ChatRequest, stream bool) (AnthropicRequest, error) {
+	// 优先使用请求或模型默认参数中的MaxTokens，其次是模型的最大输出token数
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		if model := p.findModel(req.Model); model != nil && model.MaxOutputTokens > 0 {
+			maxTokens = model.MaxOutputTokens
+		}
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	if req.Seed != nil || req.PresencePenalty != nil || req.FrequencyPenalty != nil {
+		p.logger.Debug("Anthropic不支持seed/presence_penalty/frequency_penalty参数，已忽略")
+	}
+
+	system, messages, err := translateAnthropicMessages(req.Messages)
+	if err != nil {
+		return AnthropicRequest{}, err
+	}
+
 	requestBody := AnthropicRequest{
-		Model: model,
-		Messages: []Message{
-			{Role: "user", Content: msg},
-		},
-		MaxTokens: 1000,
+		Model:         req.Model,
+		System:        system,
+		Messages:      messages,
+		MaxTokens:     maxTokens,
+		Stream:        stream,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
 	}
 
-	// 设置请求头
-	headers := map[string]string{
-		"x-api-key":         p.apiKey,
-		"anthropic-version": "2023-06-01",
+	// 转换工具定义
+	for _, tool := range req.Tools {
+		schema := tool.Parameters
+		// Anthropic要求input_schema必填
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		requestBody.Tools = append(requestBody.Tools, AnthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
 	}
 
-	// 发送请求
-	resp, err := p.sendRequest(ctx, "POST", "/v1/messages", requestBody, headers)
-	if err != nil {
-		return "", err
+	// 转换工具选择策略
+	if req.ToolChoice != nil {
+		switch req.ToolChoice.Mode {
+		case ToolChoiceRequired:
+			requestBody.ToolChoice = &AnthropicToolChoice{Type: "any"}
+		case ToolChoiceTool:
+			requestBody.ToolChoice = &AnthropicToolChoice{Type: "tool", Name: req.ToolChoice.Name}
+		default:
+			requestBody.ToolChoice = &AnthropicToolChoice{Type: req.ToolChoice.Mode}
+		}
 	}
-	defer resp.Body.Close()
+	return requestBody, nil
+}
 
-	// 解析响应
-	var response AnthropicResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+// translateAnthropicMessages 将统一的Message列表转换为Messages接口要求的形状
+// 1. system消息提升为顶层system字段，多条system消息保留为多个文本块
+// 2. 助手的工具调用转换为tool_use块，工具结果消息转换为user角色的tool_result块
+// 3. 相邻的同角色消息合并为一条消息，合并后user消息中的tool_result块排在其他内容之前
+// 4. 校验转换后的消息以user开始且内容不为空
+// 5. 校验每个tool_result紧跟在包含对应tool_use的assistant消息之后，且每个tool_use都有对应的tool_result
+func translateAnthropicMessages(messages []Message) ([]ContentBlock, []AnthropicMessage, error) {
+	var system []ContentBlock
+	result := make([]AnthropicMessage, 0, len(messages))
+
+	for i, msg := range messages {
+		var role string
+		var blocks []ContentBlock
+
+		switch msg.Role {
+		case RoleSystem:
+			for _, block := range newAnthropicContentBlocks(msg) {
+				if block.Type != "text" {
+					return nil, nil, fmt.Errorf("第%d条消息: system消息只能包含文本内容", i+1)
+				}
+				system = append(system, block)
+			}
+			continue
+		case RoleTool:
+			if msg.ToolCallID == "" {
+				return nil, nil, fmt.Errorf("第%d条消息: 工具结果消息缺少tool_call_id", i+1)
+			}
+			role = RoleUser
+			blocks = []ContentBlock{{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content}}
+		case RoleUser, RoleAssistant:
+			role = msg.Role
+			blocks = newAnthropicContentBlocks(msg)
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Arguments)
+				if len(input) == 0 {
+					input = json.RawMessage(`{}`)
+				}
+				blocks = append(blocks, ContentBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+			}
+		default:
+			return nil, nil, fmt.Errorf("第%d条消息: 不支持的角色 %q", i+1, msg.Role)
+		}
+
+		if len(blocks) == 0 {
+			return nil, nil, fmt.Errorf("第%d条消息: 内容为空", i+1)
+		}
+
+		// 合并相邻的同角色消息
+		if n := len(result); n > 0 && result[n-1].Role == role {
+			result[n-1].Content = append(result[n-1].Content, blocks...)
+			continue
+		}
+		result = append(result, AnthropicMessage{Role: role, Content: blocks})
 	}
 
-	// 检查错误
-	if response.Error != nil {
-		return "", fmt.Errorf("API错误: %s", response.Error.Message)
+	if len(result) == 0 {
+		return nil, nil, fmt.Errorf("除system消息外没有其他消息")
+	}
+	if result[0].Role != RoleUser {
+		return nil, nil, fmt.Errorf("第一条非system消息必须是user角色，当前为%s", result[0].Role)
+	}
+	for i := range result {
+		if result[i].Role == RoleUser {
+			slices.SortStableFunc(result[i].Content, func(a, b ContentBlock) int {
+				return cmp.Compare(toolResultRank(a), toolResultRank(b))
+			})
+		}
 	}
+	if err := checkAnthropicToolPairing(result); err != nil {
+		return nil, nil, err
+	}
+	return system, result, nil
+}
 
-	// 检查响应
-	if len(response.Content) == 0 {
-		return "", fmt.Errorf("响应中没有内容")
+// toolResultRank 用于将tool_result块排在user消息的其他内容之前
+func toolResultRank(block ContentBlock) int {
+	if block.Type == "tool_result" {
+		return 0
 	}
+	return 1
+}
 
-	// 提取文本内容
-	var reply strings.Builder
-	for _, block := range response.Content {
-		if block.Type == "text" {
-			reply.WriteString(block.Text)
+// checkAnthropicToolPairing 校验工具调用与工具结果一一对应：
+// tool_result必须出现在紧跟着包含同ID tool_use的assistant消息之后的user消息中，
+// 除最后一条消息外，assistant消息中的每个tool_use都必须在下一条消息中有对应的tool_result
+func checkAnthropicToolPairing(messages []AnthropicMessage) error {
+	for i, msg := range messages {
+		switch msg.Role {
+		case RoleAssistant:
+			if i == len(messages)-1 {
+				continue
+			}
+			results := blockIDs(messages[i+1].Content, "tool_result")
+			for _, block := range msg.Content {
+				if block.Type == "tool_use" && !results[block.ID] {
+					return fmt.Errorf("工具调用 %s 缺少对应的工具结果，工具结果消息需紧跟在发起调用的assistant消息之后", block.ID)
+				}
+			}
+		case RoleUser:
+			var calls map[string]bool
+			if i > 0 {
+				calls = blockIDs(messages[i-1].Content, "tool_use")
+			}
+			for _, block := range msg.Content {
+				if block.Type == "tool_result" && !calls[block.ToolUseID] {
+					return fmt.Errorf("工具结果 %s 没有对应的工具调用，工具结果消息需紧跟在包含该调用的assistant消息之后", block.ToolUseID)
+				}
+			}
 		}
 	}
+	return nil
+}
 
-	return reply.String(), nil
+// blockIDs 返回指定类型内容块的ID集合，tool_use取ID，tool_result取ToolUseID
+func blockIDs(blocks []ContentBlock, blockType string) map[string]bool {
+	ids := make(map[string]bool)
+	for _, block := range blocks {
+		switch {
+		case block.Type != blockType:
+		case blockType == "tool_result":
+			ids[block.ToolUseID] = true
+		default:
+			ids[block.ID] = true
+		}
+	}
+	return ids
 }
 
-// ChatWithContext 实现AIProvider接口的ChatWithContext方法
-func (p *AnthropicProvider) ChatWithContext(ctx context.Context, model string, messages []Message) (string, error) {
-	// 构建请求体
-	requestBody := AnthropicRequest{
-		Model:     model,
-		Messages:  messages,
-		MaxTokens: 1000,
+// newAnthropicContentBlocks 将消息的文本或内容片段转换为Anthropic内容块
+func newAnthropicContentBlocks(msg Message) []ContentBlock {
+	if msg.hasParts() {
+		blocks := make([]ContentBlock, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			blocks = append(blocks, newAnthropicContentBlock(part))
+		}
+		return blocks
 	}
+	if msg.Content != "" {
+		return []ContentBlock{{Type: "text", Text: msg.Content}}
+	}
+	return nil
+}
 
-	// 设置请求头
-	headers := map[string]string{
-		"x-api-key":        p.apiKey,
+// newAnthropicContentBlock 将统一的ContentPart映射为Anthropic内容块
+func newAnthropicContentBlock(part ContentPart) ContentBlock {
+	if part.Type == ContentPartText {
+		return ContentBlock{Type: "text", Text: part.Text}
+	}
+
+	source := &AnthropicSource{Type: "url", URL: part.URL}
+	if len(part.Data) > 0 {
+		source = &AnthropicSource{
+			Type:      "base64",
+			MediaType: part.MediaType,
+			Data:      base64.StdEncoding.EncodeToString(part.Data),
+		}
+	}
+	return ContentBlock{Type: part.Type, Source: source}
+}
+
+// headers 返回Anthropic请求所需的请求头，API Key由Key池在发送时设置
+func (p *AnthropicProvider) headers() map[string]string {
+	return map[string]string{
 		"anthropic-version": "2023-06-01",
 	}
+}
 
-	// 发送请求
-	resp, err := p.sendRequest(ctx, "POST", "/v1/messages", requestBody, headers)
+// Do 实现AIProvider接口的Do方法
+func (p *AnthropicProvider) Do(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	req, err := p.prepareRequest(req)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	requestBody, err := p.newAnthropicRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 发送请求，估算的token数包含最大输出token数，用于TPM限流
+	ctx = withRequestInfo(ctx, req.Model, EstimatePromptTokens(req)+requestBody.MaxTokens, req.Priority)
+	resp, err := p.sendRequest(ctx, "POST", "/v1/messages", requestBody, p.headers())
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// 解析响应
 	var response AnthropicResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+		return nil, fmt.Errorf("解析响应失败: %w", err)
 	}
 
 	// 检查错误
 	if response.Error != nil {
-		return "", fmt.Errorf("API错误: %s", response.Error.Message)
+		return nil, withRequestID(newAPIError(p.providerType, resp.StatusCode, response.Error), resp.Header)
 	}
 
 	// 检查响应
 	if len(response.Content) == 0 {
-		return "", fmt.Errorf("响应中没有内容")
+		return nil, fmt.Errorf("响应中没有内容")
 	}
 
-	// 提取文本内容
-	var reply strings.Builder
+	// 提取文本内容、思考内容和工具调用
+	var reply, reasoning strings.Builder
+	message := Message{Role: RoleAssistant}
 	for _, block := range response.Content {
-		if block.Type == "text" {
+		switch block.Type {
+		case "text":
 			reply.WriteString(block.Text)
+		case "thinking":
+			reasoning.WriteString(block.Thinking)
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			})
 		}
 	}
-
-	return reply.String(), nil
+	message.Content = reply.String()
+
+	return &ChatResponse{
+		ID:           response.ID,
+		Model:        response.Model,
+		Message:      message,
+		Reasoning:    reasoning.String(),
+		FinishReason: normalizeFinishReason(response.StopReason),
+		Usage:        response.Usage.toUsage(),
+	}, nil
 }
 
-// ChatStream 实现AIProvider接口的ChatStream方法
-func (p *AnthropicProvider) ChatStream(ctx context.Context, model string, msg string, callback func(chunk string) error) error {
-	// 构建请求体
-	requestBody := AnthropicRequest{
-		Model: model,
-		Messages: []Message{
-			{Role: "user", Content: msg},
-		},
-		MaxTokens: 1000,
-		Stream:    true,
-	}
-
-	// 设置请求头
-	headers := map[string]string{
-		"x-api-key":        p.apiKey,
-		"anthropic-version": "2023-06-01",
-	}
+// Chat 实现AIProvider接口的Chat方法
+func (p *AnthropicProvider) Chat(ctx context.Context, model string, msg string) (string, error) {
+	return p.ChatWithContext(ctx, model, []Message{{Role: RoleUser, Content: msg}})
+}
 
-	// 发送请求
-	resp, err := p.sendRequest(ctx, "POST", "/v1/messages", requestBody, headers)
+// ChatWithContext 实现AIProvider接口的ChatWithContext方法
+func (p *AnthropicProvider) ChatWithContext(ctx context.Context, model string, messages []Message) (string, error) {
+	resp, err := p.Do(ctx, &ChatRequest{Model: model, Messages: messages})
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer resp.Body.Close()
+	return resp.Text(), nil
+}
 
-	// 处理流式响应
-	return p.handleStreamResponse(resp.Body, callback)
+// ChatStream 实现AIProvider接口的ChatStream方法
+func (p *AnthropicProvider) ChatStream(ctx context.Context, model string, msg string, callback func(chunk string) error) error {
+	return p.ChatStreamWithContext(ctx, model, []Message{{Role: RoleUser, Content: msg}}, callback)
 }
 
 // ChatStreamWithContext 实现AIProvider接口的ChatStreamWithContext方法
 func (p *AnthropicProvider) ChatStreamWithContext(ctx context.Context, model string, messages []Message, callback func(chunk string) error) error {
-	// 构建请求体
-	requestBody := AnthropicRequest{
-		Model:     model,
-		Messages:  messages,
-		MaxTokens: 1000,
-		Stream:    true,
+	return p.DoStream(ctx, &ChatRequest{Model: model, Messages: messages}, textCallback(callback))
+}
+
+// DoStream 实现AIProvider接口的DoStream方法
+func (p *AnthropicProvider) DoStream(ctx context.Context, req *ChatRequest, callback func(event StreamEvent) error) error {
+	req, err := p.prepareRequest(req)
+	if err != nil {
+		return err
 	}
 
-	// 设置请求头
-	headers := map[string]string{
-		"x-api-key":        p.apiKey,
-		"anthropic-version": "2023-06-01",
+	requestBody, err := p.newAnthropicRequest(req, true)
+	if err != nil {
+		return err
 	}
 
-	// 发送请求
-	resp, err := p.sendRequest(ctx, "POST", "/v1/messages", requestBody, headers)
+	// 发送请求，估算的token数包含最大输出token数，用于TPM限流
+	ctx = withRequestInfo(ctx, req.Model, EstimatePromptTokens(req)+requestBody.MaxTokens, req.Priority)
+	resp, err := p.sendRequest(ctx, "POST", "/v1/messages", requestBody, p.headers())
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	// 处理流式响应
-	return p.handleStreamResponse(resp.Body, callback)
+	return withRequestID(p.handleStreamResponse(resp.Body, callback), resp.Header)
 }
 
 // handleStreamResponse 处理流式响应
-func (p *AnthropicProvider) handleStreamResponse(body io.Reader, callback func(chunk string) error) error {
+// Anthropic Messages流式接口的事件序列为：message_start，随后每个内容块依次发送
+// content_block_start、若干content_block_delta和content_block_stop，最后是message_delta和message_stop，
+// 期间可能穿插ping和error事件；没有收到message_stop就结束的流视为中断，返回包装了io.ErrUnexpectedEOF的错误
+func (p *AnthropicProvider) handleStreamResponse(body io.Reader, callback func(event StreamEvent) error) error {
 	p.logger.Info("开始处理流式响应")
-	
+
+	// 累计message_start与message_delta中的用量，在流结束时统一发送
+	var usage *AnthropicUsage
+	// 内容块序号到工具调用序号的映射
+	toolIndexes := make(map[int]int)
+
+	// emit 调用回调函数并记录失败日志
+	emit := func(event StreamEvent) error {
+		if err := callback(event); err != nil {
+			if isStreamAborted(err) {
+				p.logger.Debug("流式响应被消费方终止: %v", err)
+			} else {
+				p.logger.Error("回调函数执行失败: %v", err)
+			}
+			return err
+		}
+		return nil
+	}
+
 	// 创建一个扫描器来逐行读取响应
 	scanner := bufio.NewScanner(body)
+	// 单个事件可能包含较长的工具参数或思考内容，放宽单行长度限制
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	for scanner.Scan() {
 		line := scanner.Text()
-		// 跳过空行
-		if line == "" {
+		// 跳过空行、SSE注释以及event行（事件类型同时包含在data的type字段中）
+		if line == "" || strings.HasPrefix(line, ":") || strings.HasPrefix(line, "event:") {
 			continue
 		}
-		// 跳过SSE注释
-		if strings.HasPrefix(line, ":") {
+		if !strings.HasPrefix(line, "data:") {
 			continue
 		}
-		// 检查是否是结束信号
-		if line == "data: [DONE]" {
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		// 兼容部分代理在末尾追加的结束信号
+		if data == "[DONE]" {
 			p.logger.Info("收到流式响应结束信号")
-			break
+			return p.finishStream(usage, emit)
+		}
+
+		// 解析JSON
+		var response AnthropicStreamResponse
+		if err := json.Unmarshal([]byte(data), &response); err != nil {
+			p.logger.Error("解析流式响应失败: %v", err)
+			return fmt.Errorf("解析流式响应失败: %w", err)
 		}
-		// 提取JSON数据
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimPrefix(line, "data: ")
-			// 解析JSON
-			var response AnthropicStreamResponse
-			if err := json.Unmarshal([]byte(data), &response); err != nil {
-				p.logger.Error("解析流式响应失败: %v", err)
-				return fmt.Errorf("解析流式响应失败: %w", err)
+
+		switch response.Type {
+		case "message_start":
+			if response.Message == nil {
+				continue
+			}
+			if response.Message.Usage != nil {
+				usage = &AnthropicUsage{}
+				usage.merge(response.Message.Usage)
 			}
-			// 检查错误
-			if response.Error != nil {
-				errorMsg := fmt.Sprintf("API错误: %s", response.Error.Message)
-				p.logger.Error("%s", errorMsg)
-				return fmt.Errorf("%s", errorMsg)
+			event := StreamEvent{
+				Type:  StreamEventStart,
+				ID:    response.Message.ID,
+				Model: response.Message.Model,
+				Role:  response.Message.Role,
 			}
-			// 处理响应
-			if response.Type == "content_block_delta" && response.Message != nil {
-				for _, block := range response.Message.Content {
-					if block.Type == "text" && block.Text != "" {
-						p.logger.Debug("收到流式响应 chunk: %s", block.Text)
-						// 调用回调函数
-						if err := callback(block.Text); err != nil {
-							p.logger.Error("回调函数执行失败: %v", err)
-							return err
-						}
+			if err := emit(event); err != nil {
+				return err
+			}
+
+		case "content_block_start":
+			block := response.ContentBlock
+			if block == nil {
+				continue
+			}
+			switch block.Type {
+			case "tool_use":
+				toolIndexes[response.Index] = len(toolIndexes)
+				event := StreamEvent{
+					Type: StreamEventToolCall,
+					ToolCall: &ToolCallDelta{
+						Index: toolIndexes[response.Index],
+						ID:    block.ID,
+						Name:  block.Name,
+					},
+				}
+				if err := emit(event); err != nil {
+					return err
+				}
+			case "text":
+				// 文本块开始时通常为空，非空时作为首个增量发送
+				if block.Text != "" {
+					if err := emit(StreamEvent{Type: StreamEventText, Text: block.Text}); err != nil {
+						return err
 					}
 				}
+			case "thinking":
+				if block.Thinking != "" {
+					if err := emit(StreamEvent{Type: StreamEventReasoning, Text: block.Thinking}); err != nil {
+						return err
+					}
+				}
+			}
+
+		case "content_block_delta":
+			delta := response.Delta
+			if delta == nil {
+				continue
 			}
+			switch delta.Type {
+			case "text_delta":
+				p.logger.Debug("收到流式响应 chunk: %s", delta.Text)
+				if err := emit(StreamEvent{Type: StreamEventText, Text: delta.Text}); err != nil {
+					return err
+				}
+			case "thinking_delta":
+				if err := emit(StreamEvent{Type: StreamEventReasoning, Text: delta.Thinking}); err != nil {
+					return err
+				}
+			case "input_json_delta":
+				event := StreamEvent{
+					Type: StreamEventToolCall,
+					ToolCall: &ToolCallDelta{
+						Index:     toolIndexes[response.Index],
+						Arguments: delta.PartialJSON,
+					},
+				}
+				if err := emit(event); err != nil {
+					return err
+				}
+			case "signature_delta":
+				// 思考块签名仅用于多轮对话回传校验，不作为事件发送
+			}
+
+		case "message_delta":
+			// message_delta中包含结束原因和累计的输出用量
+			if response.Usage != nil {
+				if usage == nil {
+					usage = &AnthropicUsage{}
+				}
+				usage.merge(response.Usage)
+			}
+			if response.Delta != nil && response.Delta.StopReason != "" {
+				if err := emit(StreamEvent{Type: StreamEventStop, FinishReason: normalizeFinishReason(response.Delta.StopReason)}); err != nil {
+					return err
+				}
+			}
+
+		case "error":
+			apiErr := response.Error
+			if apiErr == nil {
+				apiErr = &Error{Message: "未知错误"}
+			}
+			err := newAPIError(p.providerType, 0, apiErr)
+			p.logger.Error("%v", err)
+			if cbErr := emit(StreamEvent{Type: StreamEventError, Err: err}); cbErr != nil {
+				return cbErr
+			}
+			return err
+
+		case "content_block_stop", "ping":
+			// 无需处理
+
+		case "message_stop":
+			p.logger.Info("收到流式响应结束信号")
+			return p.finishStream(usage, emit)
+
+		default:
+			// 忽略未知事件，以兼容接口新增的事件类型
+			p.logger.Debug("忽略未知的流式事件: %s", response.Type)
 		}
 	}
 
 	// 检查扫描器错误
 	if err := scanner.Err(); err != nil {
-		p.logger.Error("读取流式响应失败: %v", err)
+		if isStreamAborted(err) {
+			p.logger.Debug("流式响应被消费方终止: %v", err)
+		} else {
+			p.logger.Error("读取流式响应失败: %v", err)
+		}
 		return fmt.Errorf("读取流式响应失败: %w", err)
 	}
 
+	err := fmt.Errorf("流式响应在message_stop之前中断: %w", io.ErrUnexpectedEOF)
+	p.logger.Error("%v", err)
+	return err
+}
+
+// finishStream 在流结束时发送用量事件
+func (p *AnthropicProvider) finishStream(usage *AnthropicUsage, emit func(event StreamEvent) error) error {
+	if usage != nil {
+		u := usage.toUsage()
+		if err := emit(StreamEvent{Type: StreamEventUsage, Usage: &u}); err != nil {
+			return err
+		}
+	}
+
 	p.logger.Info("流式响应处理完成")
 	return nil
 }
@@ -0,0 +1,247 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+)
+
+// newAnthropicFixtureProvider 创建一个以testdata中录制的SSE事件作为响应的AnthropicProvider
+func newAnthropicFixtureProvider(t *testing.T, fixture string) AIProvider {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("读取测试数据失败: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("请求路径为%s，期望/v1/messages", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	prov, err := NewAnthropicProvider(&domain.Platform{
+		ID:      "anthropic",
+		Type:    "anthropic",
+		BaseURL: srv.URL,
+		APIKey:  "sk-ant-test-key",
+	}, WithLogLevel(utils.FatalLevel))
+	if err != nil {
+		t.Fatalf("创建Provider失败: %v", err)
+	}
+	return prov
+}
+
+// collectAnthropicStream 发送流式请求并收集所有事件
+func collectAnthropicStream(t *testing.T, fixture string) ([]StreamEvent, error) {
+	t.Helper()
+	prov := newAnthropicFixtureProvider(t, fixture)
+	var events []StreamEvent
+	err := prov.DoStream(context.Background(), &ChatRequest{
+		Model:    "claude-sonnet-4-20250514",
+		Messages: []Message{{Role: RoleUser, Content: "北京天气怎么样？"}},
+	}, func(event StreamEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+func TestAnthropicStreamEvents(t *testing.T) {
+	events, err := collectAnthropicStream(t, "anthropic_stream.sse")
+	if err != nil {
+		t.Fatalf("DoStream返回错误: %v", err)
+	}
+
+	want := []StreamEvent{
+		{Type: StreamEventStart, ID: "msg_01ZpWgZ6tQn8k3vZ1Yt2XcJm", Model: "claude-sonnet-4-20250514", Role: RoleAssistant},
+		{Type: StreamEventReasoning, Text: "用户想知道北京的天气，"},
+		{Type: StreamEventReasoning, Text: "需要调用get_weather工具。"},
+		{Type: StreamEventText, Text: "我来查询"},
+		{Type: StreamEventText, Text: "一下北京的天气。"},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 0, ID: "toolu_01T1x1fJ34qAmk2tNTrN7Up6", Name: "get_weather"}},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 0}},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 0, Arguments: `{"city": "北`}},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 0, Arguments: `京"}`}},
+		{Type: StreamEventStop, FinishReason: FinishReasonToolCalls},
+		{Type: StreamEventUsage, Usage: &Usage{InputTokens: 600, OutputTokens: 89, CachedTokens: 128}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("事件不一致\n得到: %+v\n期望: %+v", events, want)
+	}
+}
+
+func TestAnthropicStreamErrorEvent(t *testing.T) {
+	events, err := collectAnthropicStream(t, "anthropic_stream_error.sse")
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("DoStream返回%v，期望ErrOverloaded", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("收到%d个事件，期望3个: %+v", len(events), events)
+	}
+	if events[1].Type != StreamEventText || events[1].Text != "你好" {
+		t.Errorf("第2个事件为%+v，期望文本\"你好\"", events[1])
+	}
+	last := events[2]
+	if last.Type != StreamEventError || !errors.Is(last.Err, ErrOverloaded) {
+		t.Errorf("最后一个事件为%+v，期望携带ErrOverloaded的错误事件", last)
+	}
+}
+
+func TestAnthropicStreamTruncated(t *testing.T) {
+	events, err := collectAnthropicStream(t, "anthropic_stream_truncated.sse")
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("DoStream返回%v，期望io.ErrUnexpectedEOF", err)
+	}
+
+	want := []StreamEventType{StreamEventStart, StreamEventText}
+	var got []StreamEventType
+	for _, event := range events {
+		got = append(got, event.Type)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("事件类型为%v，期望%v", got, want)
+	}
+}
+
+// describeAnthropicMessages 将转换后的消息描述为"角色: 块类型(内容)"形式，便于比较
+func describeAnthropicMessages(messages []AnthropicMessage) []string {
+	described := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		s := msg.Role + ":"
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "text":
+				s += " text(" + block.Text + ")"
+			case "tool_use":
+				s += " tool_use(" + block.ID + ")"
+			case "tool_result":
+				s += " tool_result(" + block.ToolUseID + ")"
+			default:
+				s += " " + block.Type
+			}
+		}
+		described = append(described, s)
+	}
+	return described
+}
+
+func TestTranslateAnthropicMessages(t *testing.T) {
+	messages := []Message{
+		{Role: RoleSystem, Content: "你是助手"},
+		{Role: RoleUser, Content: "查询天气"},
+		{Role: RoleSystem, Content: "使用中文回答"},
+		{Role: RoleUser, Content: "北京和上海"},
+		{Role: RoleAssistant, Content: "好的", ToolCalls: []ToolCall{
+			{ID: "call_1", Name: "weather", Arguments: `{"city":"北京"}`},
+			{ID: "call_2", Name: "weather"},
+		}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: "晴"},
+		{Role: RoleUser, Content: "顺便问一下"},
+		{Role: RoleTool, ToolCallID: "call_2", Content: "雨"},
+	}
+
+	system, translated, err := translateAnthropicMessages(messages)
+	if err != nil {
+		t.Fatalf("转换失败: %v", err)
+	}
+
+	// system消息提升为顶层字段
+	if len(system) != 2 || system[0].Text != "你是助手" || system[1].Text != "使用中文回答" {
+		t.Errorf("system为%+v，期望两个文本块", system)
+	}
+	// 相邻的同角色消息合并，tool_result块排在user消息的最前面
+	want := []string{
+		"user: text(查询天气) text(北京和上海)",
+		"assistant: text(好的) tool_use(call_1) tool_use(call_2)",
+		"user: tool_result(call_1) tool_result(call_2) text(顺便问一下)",
+	}
+	if got := describeAnthropicMessages(translated); !reflect.DeepEqual(got, want) {
+		t.Errorf("转换结果为%q，期望%q", got, want)
+	}
+	// 没有参数的工具调用使用空对象
+	if input := string(translated[1].Content[2].Input); input != "{}" {
+		t.Errorf("没有参数的tool_use输入为%s，期望{}", input)
+	}
+}
+
+func TestTranslateAnthropicMessagesErrors(t *testing.T) {
+	call := func(id string) []ToolCall { return []ToolCall{{ID: id, Name: "weather"}} }
+	tests := []struct {
+		name     string
+		messages []Message
+		want     string
+	}{
+		{
+			"leading_assistant",
+			[]Message{{Role: RoleSystem, Content: "你是助手"}, {Role: RoleAssistant, Content: "你好"}, {Role: RoleUser, Content: "hi"}},
+			"第一条非system消息必须是user角色，当前为assistant",
+		},
+		{
+			"system_only",
+			[]Message{{Role: RoleSystem, Content: "你是助手"}},
+			"除system消息外没有其他消息",
+		},
+		{
+			"missing_tool_call_id",
+			[]Message{{Role: RoleUser, Content: "hi"}, {Role: RoleTool, Content: "晴"}},
+			"第2条消息: 工具结果消息缺少tool_call_id",
+		},
+		{
+			"missing_tool_result",
+			[]Message{
+				{Role: RoleUser, Content: "hi"},
+				{Role: RoleAssistant, ToolCalls: call("call_1")},
+				{Role: RoleUser, Content: "继续"},
+			},
+			"工具调用 call_1 缺少对应的工具结果，工具结果消息需紧跟在发起调用的assistant消息之后",
+		},
+		{
+			"orphan_tool_result",
+			[]Message{
+				{Role: RoleUser, Content: "hi"},
+				{Role: RoleAssistant, ToolCalls: call("call_1")},
+				{Role: RoleTool, ToolCallID: "call_1", Content: "晴"},
+				{Role: RoleAssistant, Content: "北京晴"},
+				{Role: RoleTool, ToolCallID: "call_1", Content: "晴"},
+			},
+			"工具结果 call_1 没有对应的工具调用，工具结果消息需紧跟在包含该调用的assistant消息之后",
+		},
+		{
+			"unknown_tool_result",
+			[]Message{
+				{Role: RoleUser, Content: "hi"},
+				{Role: RoleAssistant, ToolCalls: call("call_1")},
+				{Role: RoleTool, ToolCallID: "call_1", Content: "晴"},
+				{Role: RoleTool, ToolCallID: "call_9", Content: "雨"},
+			},
+			"工具结果 call_9 没有对应的工具调用，工具结果消息需紧跟在包含该调用的assistant消息之后",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := translateAnthropicMessages(tt.messages)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("错误为%v，期望%q", err, tt.want)
+			}
+		})
+	}
+
+	// 最后一条assistant消息中的工具调用尚未有结果，不视为错误
+	_, _, err := translateAnthropicMessages([]Message{{Role: RoleUser, Content: "hi"}, {Role: RoleAssistant, ToolCalls: call("call_1")}})
+	if err != nil {
+		t.Errorf("以工具调用结尾的消息转换失败: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+	// CircuitClosed 关闭，请求正常通过
+	CircuitClosed CircuitState = iota
+	// CircuitOpen 打开，请求直接失败
+	CircuitOpen
+	// CircuitHalfOpen 半开，允许少量探测请求通过
+	CircuitHalfOpen
+)
+
+// String 返回状态名称
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// ErrCircuitOpen 熔断器打开，请求未发送到上游
+var ErrCircuitOpen = errors.New("熔断器已打开")
+
+// CircuitOpenError 熔断器打开时返回的错误，可通过errors.Is(err, ErrCircuitOpen)判断
+type CircuitOpenError struct {
+	Platform   string        // 平台ID
+	RetryAfter time.Duration // 距离进入半开状态的剩余时间，半开状态探测名额已满时为0
+}
+
+// Error 实现error接口
+func (e *CircuitOpenError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("平台 %s 熔断器已打开，%v后允许探测", e.Platform, e.RetryAfter.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("平台 %s 熔断器处于半开状态，探测请求已满", e.Platform)
+}
+
+// Unwrap 返回ErrCircuitOpen
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitBreakerStats 熔断器的状态快照，便于上报监控指标
+type CircuitBreakerStats struct {
+	State               CircuitState
+	ConsecutiveFailures int       // 当前连续失败次数
+	WindowRequests      int       // 当前统计窗口内的请求数
+	WindowFailures      int       // 当前统计窗口内的失败数
+	Trips               int64     // 累计熔断次数
+	Rejected            int64     // 累计被拒绝的请求数
+	OpenedAt            time.Time // 最近一次熔断的时间
+}
+
+// CircuitBreakerReporter 定义了获取熔断器的能力，CreateProvider返回的实例可通过类型断言获取
+type CircuitBreakerReporter interface {
+	// CircuitBreaker 返回Provider的熔断器，未启用时返回nil
+	CircuitBreaker() *CircuitBreaker
+}
+
+// CircuitBreaker 平台级熔断器
+// 关闭状态下连续失败次数或统计窗口内的失败率达到阈值时打开；打开状态下请求直接失败，
+// 冷却时间过后进入半开状态，放行HalfOpenRequests个探测请求，全部成功则关闭，任一失败则重新打开
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	platform string
+	config   domain.CircuitBreakerConfig
+	stats    CircuitBreakerStats
+	// 统计窗口开始时间
+	windowStart time.Time
+	// 半开状态下已放行和已成功的探测请求数
+	halfOpenInFlight  int
+	halfOpenSucceeded int
+}
+
+// NewCircuitBreaker 创建熔断器，配置中的零值字段使用默认值
+func NewCircuitBreaker(platform string, config domain.CircuitBreakerConfig) *CircuitBreaker {
+	if config.ConsecutiveFailures <= 0 {
+		config.ConsecutiveFailures = 5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.Window <= 0 {
+		config.Window = 60 * time.Second
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		platform:    platform,
+		config:      config,
+		windowStart: time.Now(),
+	}
+}
+
+// State 返回熔断器当前状态
+func (b *CircuitBreaker) State() CircuitState {
+	return b.Stats().State
+}
+
+// Stats 返回熔断器的状态快照
+func (b *CircuitBreaker) Stats() CircuitBreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	return b.stats
+}
+
+// Allow 判断请求是否可以通过，通过后必须调用Record上报结果
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.advance(now)
+	switch b.stats.State {
+	case CircuitOpen:
+		b.stats.Rejected++
+		return &CircuitOpenError{Platform: b.platform, RetryAfter: b.stats.OpenedAt.Add(b.config.CoolDown).Sub(now)}
+	case CircuitHalfOpen:
+		if b.halfOpenInFlight >= b.config.HalfOpenRequests {
+			b.stats.Rejected++
+			return &CircuitOpenError{Platform: b.platform}
+		}
+		b.halfOpenInFlight++
+	}
+	return nil
+}
+
+// Record 上报请求结果
+// 连接失败、超时、5xx和过载视为失败；其他错误说明上游仍可响应，视为成功；
+// 调用方取消的请求和未发送到上游的请求（如客户端限流、并发排队失败）不计入统计
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.advance(now)
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrLocalRateLimit) || errors.Is(err, ErrConcurrencyLimit) {
+		if b.stats.State == CircuitHalfOpen && b.halfOpenInFlight > 0 {
+			b.halfOpenInFlight--
+		}
+		return
+	}
+
+	failed := isBreakerFailure(err)
+	switch b.stats.State {
+	case CircuitHalfOpen:
+		if failed {
+			b.trip(now)
+			return
+		}
+		b.halfOpenSucceeded++
+		if b.halfOpenSucceeded >= b.config.HalfOpenRequests {
+			b.reset(now)
+		}
+	case CircuitClosed:
+		b.stats.WindowRequests++
+		if !failed {
+			b.stats.ConsecutiveFailures = 0
+			return
+		}
+		b.stats.WindowFailures++
+		b.stats.ConsecutiveFailures++
+		if b.stats.ConsecutiveFailures >= b.config.ConsecutiveFailures || b.failureRateExceeded() {
+			b.trip(now)
+		}
+	}
+}
+
+// failureRateExceeded 判断统计窗口内的失败率是否达到阈值
+func (b *CircuitBreaker) failureRateExceeded() bool {
+	if b.config.FailureRate <= 0 || b.stats.WindowRequests < b.config.MinRequests {
+		return false
+	}
+	return float64(b.stats.WindowFailures)/float64(b.stats.WindowRequests) >= b.config.FailureRate
+}
+
+// advance 根据时间推进状态：打开状态冷却结束后进入半开，关闭状态下滚动统计窗口
+func (b *CircuitBreaker) advance(now time.Time) {
+	switch b.stats.State {
+	case CircuitOpen:
+		if !now.Before(b.stats.OpenedAt.Add(b.config.CoolDown)) {
+			b.stats.State = CircuitHalfOpen
+			b.halfOpenInFlight, b.halfOpenSucceeded = 0, 0
+		}
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.config.Window {
+			b.windowStart = now
+			b.stats.WindowRequests, b.stats.WindowFailures = 0, 0
+		}
+	}
+}
+
+// trip 打开熔断器
+func (b *CircuitBreaker) trip(now time.Time) {
+	b.stats.State = CircuitOpen
+	b.stats.OpenedAt = now
+	b.stats.Trips++
+}
+
+// reset 关闭熔断器并清空统计
+func (b *CircuitBreaker) reset(now time.Time) {
+	b.stats.State = CircuitClosed
+	b.stats.ConsecutiveFailures = 0
+	b.stats.WindowRequests, b.stats.WindowFailures = 0, 0
+	b.windowStart = now
+}
+
+// isBreakerFailure 判断错误是否说明上游不可用
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, ErrConnection) || errors.Is(err, ErrServer) ||
+		errors.Is(err, ErrOverloaded) || errors.Is(err, ErrTimeout) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+// errBreakerFailure 会被熔断器计为失败的错误
+var errBreakerFailure = fmt.Errorf("上游不可用: %w", ErrServer)
+
+// recordN 放行并上报n次相同的结果
+func recordN(t *testing.T, b *CircuitBreaker, n int, err error) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if allowErr := b.Allow(); allowErr != nil {
+			t.Fatalf("第%d次请求被拒绝: %v", i+1, allowErr)
+		}
+		b.Record(err)
+	}
+}
+
+func TestCircuitBreakerTripsOnConsecutiveFailures(t *testing.T) {
+	b := NewCircuitBreaker("p", domain.CircuitBreakerConfig{ConsecutiveFailures: 3, CoolDown: time.Hour})
+
+	recordN(t, b, 2, errBreakerFailure)
+	recordN(t, b, 1, nil) // 成功清零连续失败次数
+	recordN(t, b, 2, errBreakerFailure)
+	if got := b.State(); got != CircuitClosed {
+		t.Fatalf("连续失败2次后状态为%v，期望closed", got)
+	}
+
+	recordN(t, b, 1, errBreakerFailure)
+	if got := b.State(); got != CircuitOpen {
+		t.Fatalf("连续失败3次后状态为%v，期望open", got)
+	}
+	err := b.Allow()
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.RetryAfter <= 0 {
+		t.Fatalf("打开状态下Allow返回%v，期望带RetryAfter的CircuitOpenError", err)
+	}
+	if stats := b.Stats(); stats.Trips != 1 || stats.Rejected != 1 {
+		t.Errorf("统计为%+v，期望Trips=1、Rejected=1", stats)
+	}
+}
+
+func TestCircuitBreakerTripsOnFailureRate(t *testing.T) {
+	b := NewCircuitBreaker("p", domain.CircuitBreakerConfig{
+		ConsecutiveFailures: 100,
+		FailureRate:         0.5,
+		MinRequests:         10,
+		Window:              time.Hour,
+		CoolDown:            time.Hour,
+	})
+
+	// 9个请求中失败5个，失败率超过阈值但请求数不足MinRequests
+	for i := 0; i < 9; i++ {
+		var err error
+		if i%2 == 0 {
+			err = errBreakerFailure
+		}
+		recordN(t, b, 1, err)
+	}
+	if got := b.State(); got != CircuitClosed {
+		t.Fatalf("请求数不足MinRequests时状态为%v，期望closed", got)
+	}
+
+	recordN(t, b, 1, errBreakerFailure)
+	if got := b.State(); got != CircuitOpen {
+		t.Fatalf("达到MinRequests且失败率6/10时状态为%v，期望open", got)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	const coolDown = 20 * time.Millisecond
+	b := NewCircuitBreaker("p", domain.CircuitBreakerConfig{ConsecutiveFailures: 1, CoolDown: coolDown, HalfOpenRequests: 2})
+
+	recordN(t, b, 1, errBreakerFailure)
+	if got := b.State(); got != CircuitOpen {
+		t.Fatalf("状态为%v，期望open", got)
+	}
+
+	time.Sleep(coolDown + 5*time.Millisecond)
+	if got := b.State(); got != CircuitHalfOpen {
+		t.Fatalf("冷却结束后状态为%v，期望half_open", got)
+	}
+
+	// 半开状态只放行HalfOpenRequests个探测请求
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("第%d个探测请求被拒绝: %v", i+1, err)
+		}
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("超出HalfOpenRequests的请求返回%v，期望ErrCircuitOpen", err)
+	}
+
+	// 全部探测成功后关闭
+	b.Record(nil)
+	if got := b.State(); got != CircuitHalfOpen {
+		t.Fatalf("1个探测成功后状态为%v，期望仍为half_open", got)
+	}
+	b.Record(nil)
+	if got := b.State(); got != CircuitClosed {
+		t.Fatalf("全部探测成功后状态为%v，期望closed", got)
+	}
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+	const coolDown = 20 * time.Millisecond
+	b := NewCircuitBreaker("p", domain.CircuitBreakerConfig{ConsecutiveFailures: 1, CoolDown: coolDown})
+
+	recordN(t, b, 1, errBreakerFailure)
+	time.Sleep(coolDown + 5*time.Millisecond)
+	recordN(t, b, 1, errBreakerFailure)
+
+	stats := b.Stats()
+	if stats.State != CircuitOpen || stats.Trips != 2 {
+		t.Fatalf("探测失败后统计为%+v，期望重新打开且Trips=2", stats)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("重新打开后Allow返回%v，期望ErrCircuitOpen", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresLocalErrors(t *testing.T) {
+	neutral := []error{
+		context.Canceled,
+		fmt.Errorf("%w: 等待配额超时", ErrLocalRateLimit),
+		fmt.Errorf("%w: %w", ErrConcurrencyLimit, context.DeadlineExceeded),
+	}
+	for _, err := range neutral {
+		t.Run(err.Error(), func(t *testing.T) {
+			b := NewCircuitBreaker("p", domain.CircuitBreakerConfig{ConsecutiveFailures: 1, MinRequests: 1, FailureRate: 0.1})
+			recordN(t, b, 3, err)
+			stats := b.Stats()
+			if stats.State != CircuitClosed || stats.WindowRequests != 0 || stats.ConsecutiveFailures != 0 {
+				t.Fatalf("上报%v后统计为%+v，期望不计入统计", err, stats)
+			}
+		})
+	}
+
+	t.Run("half_open", func(t *testing.T) {
+		const coolDown = 20 * time.Millisecond
+		b := NewCircuitBreaker("p", domain.CircuitBreakerConfig{ConsecutiveFailures: 1, CoolDown: coolDown})
+		recordN(t, b, 1, errBreakerFailure)
+		time.Sleep(coolDown + 5*time.Millisecond)
+
+		// 被取消的探测请求归还名额，不影响状态
+		recordN(t, b, 1, context.Canceled)
+		if got := b.State(); got != CircuitHalfOpen {
+			t.Fatalf("探测请求被取消后状态为%v，期望half_open", got)
+		}
+		recordN(t, b, 1, nil)
+		if got := b.State(); got != CircuitClosed {
+			t.Fatalf("探测成功后状态为%v，期望closed", got)
+		}
+	})
+}
@@ -0,0 +1,255 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// CoalesceStats 请求合并的统计
+type CoalesceStats struct {
+	Requests  int64 // 累计请求数
+	Coalesced int64 // 合并到进行中请求、没有单独发送到上游的请求数
+	InFlight  int   // 当前进行中的上游请求数
+}
+
+// CoalescingProvider 请求合并层，包装AIProvider并合并相同的进行中请求
+// 模型、消息、生成参数和优先级完全相同的请求在上游请求完成前只发送一次，结果交给所有等待的调用方；
+// 流式请求的事件会分发给每个调用方的回调，中途加入的调用方会先收到已产生的事件。
+// 每个被包装的Provider对应一个平台，不同平台的请求不会合并；包装Router时按Router的路由结果转发。
+// 上游请求不受单个调用方取消的影响，所有调用方都取消后才会取消上游请求。
+// 返回的ChatResponse和StreamEvent由所有调用方共享底层数据，调用方不应修改其中的切片和指针
+type CoalescingProvider struct {
+	AIProvider
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+	stats CoalesceStats
+}
+
+// NewCoalescingProvider 创建请求合并层
+func NewCoalescingProvider(prov AIProvider) *CoalescingProvider {
+	return &CoalescingProvider{
+		AIProvider: prov,
+		calls:      make(map[string]*coalescedCall),
+	}
+}
+
+// Unwrap 返回被包装的Provider，可用于类型断言获取Embedder、ModelLister等能力
+func (p *CoalescingProvider) Unwrap() AIProvider {
+	return p.AIProvider
+}
+
+// Stats 返回请求合并的统计
+func (p *CoalescingProvider) Stats() CoalesceStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.InFlight = len(p.calls)
+	return stats
+}
+
+// coalescedCall 一次进行中的上游请求
+type coalescedCall struct {
+	key     string
+	cancel  context.CancelFunc
+	waiters int // 等待结果的调用方数量，由CoalescingProvider.mu保护
+
+	mu     sync.Mutex
+	events []StreamEvent
+	notify chan struct{} // 有新事件或请求结束时关闭并替换
+	done   chan struct{} // 请求结束时关闭
+	resp   *ChatResponse
+	err    error
+}
+
+// publish 记录流式事件并通知所有调用方
+func (c *coalescedCall) publish(event StreamEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+	close(c.notify)
+	c.notify = make(chan struct{})
+	return nil
+}
+
+// finish 记录请求结果并通知所有调用方
+func (c *coalescedCall) finish(resp *ChatResponse, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resp = resp
+	c.err = err
+	close(c.notify)
+	close(c.done)
+}
+
+// next 返回第i个流式事件，事件尚未产生时等待；请求结束且没有更多事件时返回false和请求的错误
+func (c *coalescedCall) next(ctx context.Context, i int) (StreamEvent, bool, error) {
+	for {
+		c.mu.Lock()
+		if i < len(c.events) {
+			event := c.events[i]
+			c.mu.Unlock()
+			return event, true, nil
+		}
+		notify := c.notify
+		select {
+		case <-c.done:
+			c.mu.Unlock()
+			return StreamEvent{}, false, c.err
+		default:
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return StreamEvent{}, false, ctx.Err()
+		}
+	}
+}
+
+// join 加入相同的进行中请求，不存在时创建并在后台执行run
+// 返回的请求在调用方不再等待时必须调用leave
+func (p *CoalescingProvider) join(ctx context.Context, key string, run func(ctx context.Context, c *coalescedCall) (*ChatResponse, error)) *coalescedCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stats.Requests++
+	if c, ok := p.calls[key]; ok {
+		c.waiters++
+		p.stats.Coalesced++
+		return c
+	}
+
+	// 上游请求保留发起者上下文中的值，但不随发起者取消
+	upstream, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &coalescedCall{
+		key:     key,
+		cancel:  cancel,
+		waiters: 1,
+		notify:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	p.calls[key] = c
+
+	go func() {
+		resp, err := run(upstream, c)
+		p.mu.Lock()
+		if p.calls[key] == c {
+			delete(p.calls, key)
+		}
+		p.mu.Unlock()
+		c.finish(resp, err)
+		cancel()
+	}()
+	return c
+}
+
+// leave 调用方不再等待请求结果，最后一个调用方离开时取消上游请求
+func (p *CoalescingProvider) leave(c *coalescedCall) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	if p.calls[c.key] == c {
+		delete(p.calls, c.key)
+	}
+	c.cancel()
+}
+
+// coalesceKey 计算请求的合并键
+// Priority参与比较，避免低优先级的上游请求让高优先级的调用方排在后面
+func coalesceKey(kind string, req *ChatRequest) (string, error) {
+	data, err := json.Marshal(struct {
+		Kind    string
+		Request *ChatRequest
+	}{kind, req})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Do 实现AIProvider接口的Do方法，相同的进行中请求共享同一个响应
+func (p *CoalescingProvider) Do(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	key, err := coalesceKey("do", req)
+	if err != nil {
+		return p.AIProvider.Do(ctx, req)
+	}
+
+	upstreamReq := *req
+	c := p.join(ctx, key, func(ctx context.Context, c *coalescedCall) (*ChatResponse, error) {
+		return p.AIProvider.Do(ctx, &upstreamReq)
+	})
+	defer p.leave(c)
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	resp := *c.resp
+	return &resp, nil
+}
+
+// DoStream 实现AIProvider接口的DoStream方法，相同的进行中请求共享同一个上游流
+// 每个调用方的回调在各自的goroutine中执行，回调返回错误时只有该调用方停止接收
+func (p *CoalescingProvider) DoStream(ctx context.Context, req *ChatRequest, callback func(event StreamEvent) error) error {
+	key, err := coalesceKey("stream", req)
+	if err != nil {
+		return p.AIProvider.DoStream(ctx, req, callback)
+	}
+
+	upstreamReq := *req
+	c := p.join(ctx, key, func(ctx context.Context, c *coalescedCall) (*ChatResponse, error) {
+		return nil, p.AIProvider.DoStream(ctx, &upstreamReq, c.publish)
+	})
+	defer p.leave(c)
+
+	for i := 0; ; i++ {
+		event, ok, err := c.next(ctx, i)
+		if !ok {
+			return err
+		}
+		if err := callback(event); err != nil {
+			return err
+		}
+	}
+}
+
+// Chat 实现AIProvider接口的Chat方法
+func (p *CoalescingProvider) Chat(ctx context.Context, model string, msg string) (string, error) {
+	return p.ChatWithContext(ctx, model, []Message{{Role: RoleUser, Content: msg}})
+}
+
+// ChatWithContext 实现AIProvider接口的ChatWithContext方法
+func (p *CoalescingProvider) ChatWithContext(ctx context.Context, model string, messages []Message) (string, error) {
+	resp, err := p.Do(ctx, &ChatRequest{Model: model, Messages: messages})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
+}
+
+// ChatStream 实现AIProvider接口的ChatStream方法
+func (p *CoalescingProvider) ChatStream(ctx context.Context, model string, msg string, callback func(chunk string) error) error {
+	return p.ChatStreamWithContext(ctx, model, []Message{{Role: RoleUser, Content: msg}}, callback)
+}
+
+// ChatStreamWithContext 实现AIProvider接口的ChatStreamWithContext方法
+func (p *CoalescingProvider) ChatStreamWithContext(ctx context.Context, model string, messages []Message, callback func(chunk string) error) error {
+	return p.DoStream(ctx, &ChatRequest{Model: model, Messages: messages}, textCallback(callback))
+}
+
+// 确保CoalescingProvider实现了AIProvider接口
+var _ AIProvider = (*CoalescingProvider)(nil)
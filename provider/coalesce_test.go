@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingProvider 在release关闭前阻塞的上游，记录调用次数和取消情况
+type blockingProvider struct {
+	AIProvider
+
+	calls    atomic.Int32
+	started  chan struct{} // 上游请求开始后关闭
+	release  chan struct{} // 关闭后上游请求返回
+	canceled chan struct{} // 上游请求被取消时关闭
+	once     sync.Once
+}
+
+func newBlockingProvider() *blockingProvider {
+	return &blockingProvider{
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+		canceled: make(chan struct{}),
+	}
+}
+
+func (p *blockingProvider) wait(ctx context.Context) error {
+	p.once.Do(func() { close(p.started) })
+	select {
+	case <-p.release:
+		return nil
+	case <-ctx.Done():
+		close(p.canceled)
+		return ctx.Err()
+	}
+}
+
+func (p *blockingProvider) Do(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	p.calls.Add(1)
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &ChatResponse{Model: req.Model, Message: Message{Role: RoleAssistant, Content: "你好"}}, nil
+}
+
+// DoStream 先发送一个事件，release关闭后再发送一个事件
+func (p *blockingProvider) DoStream(ctx context.Context, req *ChatRequest, callback func(event StreamEvent) error) error {
+	p.calls.Add(1)
+	if err := callback(StreamEvent{Type: StreamEventText, Text: "你"}); err != nil {
+		return err
+	}
+	if err := p.wait(ctx); err != nil {
+		return err
+	}
+	return callback(StreamEvent{Type: StreamEventText, Text: "好"})
+}
+
+// waitForWaiters 等待合并层中的请求有n个调用方
+func waitForWaiters(t *testing.T, p *CoalescingProvider, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.Lock()
+		waiters := 0
+		for _, c := range p.calls {
+			waiters += c.waiters
+		}
+		p.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%d个调用方超时，当前为%d", n, waiters)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalescingProviderDo(t *testing.T) {
+	upstream := newBlockingProvider()
+	p := NewCoalescingProvider(upstream)
+	req := &ChatRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+
+	const n = 5
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := p.Do(context.Background(), req)
+			if err != nil {
+				t.Errorf("Do失败: %v", err)
+				return
+			}
+			if resp.Text() != "你好" {
+				t.Errorf("响应为%q，期望%q", resp.Text(), "你好")
+			}
+		}()
+	}
+	waitForWaiters(t, p, n)
+	close(upstream.release)
+	wg.Wait()
+
+	if calls := upstream.calls.Load(); calls != 1 {
+		t.Errorf("上游调用%d次，期望1次", calls)
+	}
+	if stats := p.Stats(); stats.Requests != n || stats.Coalesced != n-1 || stats.InFlight != 0 {
+		t.Errorf("统计为%+v，期望Requests=%d、Coalesced=%d、InFlight=0", stats, n, n-1)
+	}
+}
+
+func TestCoalescingProviderKey(t *testing.T) {
+	base := &ChatRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+	key := func(req *ChatRequest) string {
+		k, err := coalesceKey("do", req)
+		if err != nil {
+			t.Fatalf("计算合并键失败: %v", err)
+		}
+		return k
+	}
+
+	withParts := *base
+	withParts.Messages = []Message{{Role: RoleUser, Parts: []ContentPart{{Type: ContentPartText, Text: "hi"}, {Type: ContentPartText, Text: "there"}}}}
+	otherParts := *base
+	otherParts.Messages = []Message{{Role: RoleUser, Parts: []ContentPart{{Type: ContentPartText, Text: "hi"}, {Type: ContentPartText, Text: "again"}}}}
+	if key(&withParts) == key(&otherParts) {
+		t.Error("多模态内容不同的请求合并键相同")
+	}
+
+	interactive := *base
+	interactive.Priority = PriorityInteractive
+	if key(base) == key(&interactive) {
+		t.Error("优先级不同的请求合并键相同")
+	}
+}
+
+func TestCoalescingProviderStreamLateJoin(t *testing.T) {
+	upstream := newBlockingProvider()
+	p := NewCoalescingProvider(upstream)
+	req := &ChatRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+
+	stream := func(result chan<- string) {
+		var text string
+		err := p.ChatStreamWithContext(context.Background(), req.Model, req.Messages, func(chunk string) error {
+			text += chunk
+			return nil
+		})
+		if err != nil {
+			t.Errorf("ChatStreamWithContext失败: %v", err)
+		}
+		result <- text
+	}
+
+	first := make(chan string, 1)
+	go stream(first)
+	// 上游已发送第一个事件后再加入
+	<-upstream.started
+	second := make(chan string, 1)
+	go stream(second)
+	waitForWaiters(t, p, 2)
+	close(upstream.release)
+
+	for _, result := range []chan string{first, second} {
+		if text := <-result; text != "你好" {
+			t.Errorf("收到%q，期望中途加入的调用方也收到全部事件%q", text, "你好")
+		}
+	}
+	if calls := upstream.calls.Load(); calls != 1 {
+		t.Errorf("上游调用%d次，期望1次", calls)
+	}
+}
+
+func TestCoalescingProviderCancel(t *testing.T) {
+	upstream := newBlockingProvider()
+	p := NewCoalescingProvider(upstream)
+	req := &ChatRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { _, err := p.Do(ctx1, req); errs <- err }()
+	go func() { _, err := p.Do(ctx2, req); errs <- err }()
+	waitForWaiters(t, p, 2)
+	<-upstream.started
+
+	cancel1()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消的调用方返回%v，期望context.Canceled", err)
+	}
+	select {
+	case <-upstream.canceled:
+		t.Fatal("还有调用方等待时上游请求被取消")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel2()
+	<-errs
+	select {
+	case <-upstream.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("所有调用方离开后上游请求没有被取消")
+	}
+}
@@ -7,16 +7,26 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
+	"github.com/cn-maul/Baize/domain"
 	"github.com/cn-maul/Baize/pkg/utils"
 )
 
 // BaseProvider 是所有Provider的基础结构，包含公共逻辑
 type BaseProvider struct {
-	baseURL string
-	apiKey  string
-	client  *http.Client
-	logger  *utils.Logger
+	providerType string           // 平台类型，用于构造APIError
+	platform     *domain.Platform // 平台配置
+	baseURL      string
+	keys         *keyPool
+	authorize    func(header http.Header, key string) // 将API Key写入请求头，由具体Provider设置
+	client       *http.Client
+	retryPolicy  RetryPolicy
+	breaker      *CircuitBreaker     // 熔断器，nil表示不启用
+	limiter      *RateLimiter        // 客户端限流器，nil表示不限流
+	concurrency  *ConcurrencyLimiter // 并发限制器，nil表示不限制
+	opts         *ProviderOptions
+	logger       *utils.Logger
 }
 
 // NewBaseProvider 创建一个新的BaseProvider实例
@@ -32,32 +42,202 @@ func NewBaseProvider(baseURL, apiKey string, options ...ProviderOption) *BasePro
 		Transport: sharedClient.Transport,
 	}
 
+	// 未指定重试策略时根据最大重试次数使用指数退避
+	retryPolicy := opts.RetryPolicy
+	if retryPolicy == nil {
+		retryPolicy = NewExponentialBackoff(opts.MaxRetries)
+	}
+
 	return &BaseProvider{
-		baseURL: baseURL,
-		apiKey:  apiKey,
-		client:  client,
-		logger:  utils.NewLogger(opts.LogLevel),
+		baseURL:     baseURL,
+		keys:        newKeyPool([]string{apiKey}, opts.KeySelection),
+		client:      client,
+		retryPolicy: retryPolicy,
+		opts:        opts,
+		logger:      utils.NewLogger(opts.LogLevel),
+	}
+}
+
+// setPlatform 设置平台配置，并使用平台的所有API Key初始化Key池
+// Key选择策略优先使用WithKeySelection指定的策略，其次是平台配置中的key_selection
+func (p *BaseProvider) setPlatform(platform *domain.Platform) {
+	p.platform = platform
+	selection := p.opts.KeySelection
+	if selection == "" {
+		selection = platform.KeySelection
+	}
+	p.keys = newKeyPool(platform.Keys(), selection)
+
+	// 熔断器优先使用WithCircuitBreaker指定的配置，其次是平台配置中的circuit_breaker
+	breakerConfig := p.opts.CircuitBreaker
+	if breakerConfig == nil {
+		breakerConfig = platform.CircuitBreaker
+	}
+	if breakerConfig != nil {
+		p.breaker = NewCircuitBreaker(platform.ID, *breakerConfig)
+	}
+
+	// 限流配置优先使用WithRateLimit指定的配置，其次是平台配置中的rate_limit
+	rateLimit := p.opts.RateLimit
+	if rateLimit == nil {
+		rateLimit = platform.RateLimit
+	}
+	if rateLimit != nil {
+		p.limiter = NewRateLimiter(*rateLimit)
+	}
+
+	// 并发限制优先使用WithConcurrency指定的配置，其次是平台配置中的concurrency
+	concurrency := p.opts.Concurrency
+	if concurrency == nil {
+		concurrency = platform.Concurrency
 	}
+	if concurrency != nil {
+		p.concurrency = NewConcurrencyLimiter(*concurrency)
+	}
+}
+
+// CircuitBreaker 实现CircuitBreakerReporter接口，返回Provider的熔断器，未启用时返回nil
+func (p *BaseProvider) CircuitBreaker() *CircuitBreaker {
+	return p.breaker
+}
+
+// KeyHealth 实现KeyHealthReporter接口，返回平台各个API Key的健康状况
+func (p *BaseProvider) KeyHealth() []KeyHealth {
+	return p.keys.health()
+}
+
+// requestInfoKey 上下文中请求信息的键
+type requestInfoKey struct{}
+
+// requestInfo 限流和并发控制所需的请求信息，由Do/DoStream写入上下文，在发送请求时读取
+type requestInfo struct {
+	model    string
+	tokens   int
+	priority int
+}
+
+// withRequestInfo 将请求的模型、估算token数和优先级写入上下文
+func withRequestInfo(ctx context.Context, model string, tokens, priority int) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, requestInfo{model: model, tokens: tokens, priority: priority})
+}
+
+// requestInfoFrom 读取上下文中的请求信息，未设置时返回零值
+func requestInfoFrom(ctx context.Context) requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(requestInfo)
+	return info
 }
 
 // sendRequest 发送HTTP请求并处理响应
+// 启用熔断器时熔断器打开则直接失败；启用并发限制时每次尝试前排队获取执行机会，见sendWithRetry
 func (p *BaseProvider) sendRequest(ctx context.Context, method, endpoint string, reqBody interface{}, headers map[string]string) (*http.Response, error) {
-	// 序列化请求体
-	requestJSON, err := json.Marshal(reqBody)
-	if err != nil {
-		p.logger.Error("序列化请求体失败: %v", err)
-		return nil, fmt.Errorf("序列化请求体失败: %w", err)
+	return p.sendWithBreaker(ctx, method, endpoint, reqBody, headers)
+}
+
+// sendWithBreaker 经过熔断器发送HTTP请求，未启用熔断器时直接发送
+func (p *BaseProvider) sendWithBreaker(ctx context.Context, method, endpoint string, reqBody interface{}, headers map[string]string) (*http.Response, error) {
+	if p.breaker == nil {
+		return p.sendWithRetry(ctx, method, endpoint, reqBody, headers)
+	}
+	if err := p.breaker.Allow(); err != nil {
+		p.logger.Warn("%v", err)
+		return nil, err
+	}
+	resp, err := p.sendWithRetry(ctx, method, endpoint, reqBody, headers)
+	p.breaker.Record(err)
+	return resp, err
+}
+
+// sendWithRetry 发送HTTP请求，失败时按重试策略重试
+// 每次尝试先等待限流配额，再获取并发执行机会；执行机会在失败后立即释放，不会在重试等待期间占用，
+// 成功时直到响应体关闭才释放
+func (p *BaseProvider) sendWithRetry(ctx context.Context, method, endpoint string, reqBody interface{}, headers map[string]string) (*http.Response, error) {
+	// 序列化请求体，GET等请求没有请求体
+	var requestJSON []byte
+	if reqBody != nil {
+		var err error
+		requestJSON, err = json.Marshal(reqBody)
+		if err != nil {
+			p.logger.Error("序列化请求体失败: %v", err)
+			return nil, fmt.Errorf("序列化请求体失败: %w", err)
+		}
 	}
 
+	// 本次调用中因Key不可用而立即换Key的次数
+	switches := 0
+	for attempt := 1; ; attempt++ {
+		// 每次尝试重新选择Key，被限流的Key重试时会换用其他Key
+		key := p.keys.acquire()
+		// 等待客户端限流配额，每次尝试都会消耗配额
+		if err := p.waitRateLimit(ctx, key); err != nil {
+			p.logger.Warn("%v", err)
+			return nil, err
+		}
+		release, err := p.acquireConcurrency(ctx)
+		if err != nil {
+			p.logger.Warn("%v", err)
+			return nil, err
+		}
+		resp, err := p.doRequest(ctx, method, endpoint, requestJSON, key, headers)
+		p.keys.report(key, err)
+		if err == nil {
+			return holdUntilClosed(resp, release), nil
+		}
+		release()
+
+		// 调用方已取消或超时，不再重试
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// 当前Key被限流或认证失败且池中还有可用Key时，立即换用其他Key重试
+		// Key的暂停时间可能短于一次请求，因此每次调用最多换Key size-1 次（每个Key各尝试一次），之后按重试策略退避
+		if isKeyFailure(err) && switches < p.keys.size()-1 && p.keys.available() > 0 {
+			switches++
+			p.logger.Warn("API Key不可用，换用其他Key重试: %v", err)
+			continue
+		}
+		delay, retry := p.retryPolicy.Backoff(attempt, err)
+		if !retry {
+			return nil, err
+		}
+		// 等待时间超过上下文截止时间时放弃重试
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			p.logger.Warn("重试等待时间%v超过上下文截止时间，放弃重试", delay)
+			return nil, err
+		}
+
+		p.logger.Warn("请求失败，%v后进行第%d次重试: %v", delay, attempt, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// doRequest 发送单次HTTP请求，非2xx响应转换为APIError
+func (p *BaseProvider) doRequest(ctx context.Context, method, endpoint string, requestJSON []byte, key string, headers map[string]string) (*http.Response, error) {
 	// 创建HTTP请求
-	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+endpoint, bytes.NewBuffer(requestJSON))
+	var body io.Reader
+	if requestJSON != nil {
+		body = bytes.NewReader(requestJSON)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+endpoint, body)
 	if err != nil {
 		p.logger.Error("创建请求失败: %v", err)
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	// 设置默认请求头
-	req.Header.Set("Content-Type", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// 设置认证请求头
+	if p.authorize != nil && key != "" {
+		p.authorize(req.Header, key)
+	}
 
 	// 设置自定义请求头
 	for key, value := range headers {
@@ -73,14 +253,18 @@ func (p *BaseProvider) sendRequest(ctx context.Context, method, endpoint string,
 			sanitizedHeaders[key] = value
 		}
 	}
-	p.logger.Info("发送HTTP请求: %s %s", method, req.URL.String())
+	p.logger.Info("发送HTTP请求: %s %s (key: %s)", method, req.URL.String(), utils.MaskAPIKey(key))
 	p.logger.Debug("请求头: %v", sanitizedHeaders)
 
 	// 发送请求
 	resp, err := p.client.Do(req)
 	if err != nil {
 		p.logger.Error("发送请求失败: %v", err)
-		return nil, fmt.Errorf("发送请求失败: %w", err)
+		// 调用方取消导致的失败不视为连接错误
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("发送请求失败: %w", err)
+		}
+		return nil, fmt.Errorf("发送请求失败: %w: %w", ErrConnection, err)
 	}
 
 	// 记录响应状态码
@@ -90,9 +274,9 @@ func (p *BaseProvider) sendRequest(ctx context.Context, method, endpoint string,
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		errorMsg := fmt.Sprintf("HTTP请求失败: %d, body: %s", resp.StatusCode, string(body))
-		p.logger.Error("%s", errorMsg)
-		return nil, fmt.Errorf("%s", errorMsg)
+		apiErr := newHTTPAPIError(p.providerType, resp, body)
+		p.logger.Error("HTTP请求失败: %v", apiErr)
+		return nil, apiErr
 	}
 
 	return resp, nil
@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+// ErrConcurrencyLimit 并发请求数已满且无法排队，或排队期间上下文结束，请求未发送到上游
+var ErrConcurrencyLimit = errors.New("并发请求数已满")
+
+// ConcurrencyStats 并发限制器的状态快照，便于上报监控指标
+type ConcurrencyStats struct {
+	MaxInFlight int           // 最大并发数
+	InFlight    int           // 当前进行中的请求数
+	QueueDepth  int           // 当前排队的请求数
+	Acquired    int64         // 累计获得执行机会的请求数
+	Queued      int64         // 累计经过排队的请求数
+	Rejected    int64         // 累计因队列已满被拒绝的请求数
+	Canceled    int64         // 累计在排队期间取消的请求数
+	TotalWait   time.Duration // 累计排队时间
+	MaxWait     time.Duration // 最长排队时间
+}
+
+// AvgWait 返回经过排队的请求的平均排队时间
+func (s ConcurrencyStats) AvgWait() time.Duration {
+	if s.Queued == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Queued)
+}
+
+// ConcurrencyReporter 定义了获取并发限制器的能力，CreateProvider返回的实例可通过类型断言获取
+type ConcurrencyReporter interface {
+	// ConcurrencyLimiter 返回Provider的并发限制器，未启用时返回nil
+	ConcurrencyLimiter() *ConcurrencyLimiter
+}
+
+// waiter 排队中的请求
+type waiter struct {
+	priority int
+	seq      uint64        // 入队顺序，同优先级先进先出
+	ready    chan struct{} // 获得执行机会时关闭
+	index    int           // 在堆中的位置，出队后为-1
+}
+
+// waitQueue 按优先级排序的等待队列，实现heap.Interface
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+// ConcurrencyLimiter 带优先级队列的并发限制器
+// 进行中的请求达到上限时新请求排队，有空位时优先级高的请求先执行，同优先级按到达顺序执行
+type ConcurrencyLimiter struct {
+	mu       sync.Mutex
+	maxQueue int
+	queue    waitQueue
+	seq      uint64
+	stats    ConcurrencyStats
+}
+
+// NewConcurrencyLimiter 创建并发限制器，MaxInFlight小于1时按1处理
+func NewConcurrencyLimiter(config domain.ConcurrencyConfig) *ConcurrencyLimiter {
+	if config.MaxInFlight < 1 {
+		config.MaxInFlight = 1
+	}
+	return &ConcurrencyLimiter{
+		maxQueue: config.MaxQueue,
+		stats:    ConcurrencyStats{MaxInFlight: config.MaxInFlight},
+	}
+}
+
+// Stats 返回并发限制器的状态快照
+func (l *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	stats.QueueDepth = len(l.queue)
+	return stats
+}
+
+// Acquire 获取执行机会，成功后必须调用返回的release函数释放
+// 队列已满或排队期间上下文结束时返回包装了ErrConcurrencyLimit的错误
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, priority int) (release func(), err error) {
+	l.mu.Lock()
+	if l.stats.InFlight < l.stats.MaxInFlight && len(l.queue) == 0 {
+		l.stats.InFlight++
+		l.stats.Acquired++
+		l.mu.Unlock()
+		return l.releaseFunc(), nil
+	}
+	if l.maxQueue > 0 && len(l.queue) >= l.maxQueue {
+		l.stats.Rejected++
+		l.mu.Unlock()
+		return nil, fmt.Errorf("%w: 排队请求数已达上限%d", ErrConcurrencyLimit, l.maxQueue)
+	}
+	l.seq++
+	w := &waiter{priority: priority, seq: l.seq, ready: make(chan struct{})}
+	heap.Push(&l.queue, w)
+	l.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+		l.recordWait(time.Since(start))
+		return l.releaseFunc(), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		if w.index >= 0 {
+			heap.Remove(&l.queue, w.index)
+			l.stats.Canceled++
+			l.mu.Unlock()
+			return nil, fmt.Errorf("%w: %w", ErrConcurrencyLimit, ctx.Err())
+		}
+		l.mu.Unlock()
+		// 取消的同时已获得执行机会，将其转交给下一个请求
+		l.recordWait(time.Since(start))
+		l.release()
+		return nil, fmt.Errorf("%w: %w", ErrConcurrencyLimit, ctx.Err())
+	}
+}
+
+// recordWait 记录排队时间
+func (l *ConcurrencyLimiter) recordWait(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Queued++
+	l.stats.TotalWait += wait
+	l.stats.MaxWait = max(l.stats.MaxWait, wait)
+}
+
+// releaseFunc 返回只生效一次的释放函数
+func (l *ConcurrencyLimiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(l.release)
+	}
+}
+
+// release 释放执行机会，队列非空时直接转交给优先级最高的请求
+func (l *ConcurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) > 0 {
+		w := heap.Pop(&l.queue).(*waiter)
+		l.stats.Acquired++
+		close(w.ready)
+		return
+	}
+	l.stats.InFlight--
+}
+
+// releaseOnClose 在响应体关闭时释放执行机会，流式响应在读取结束前一直占用
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close 关闭响应体并释放执行机会
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
+
+// acquireConcurrency 获取执行机会，未启用并发限制时返回空的释放函数
+func (p *BaseProvider) acquireConcurrency(ctx context.Context) (func(), error) {
+	if p.concurrency == nil {
+		return func() {}, nil
+	}
+	return p.concurrency.Acquire(ctx, requestInfoFrom(ctx).priority)
+}
+
+// holdUntilClosed 将执行机会的释放推迟到响应体关闭时
+func holdUntilClosed(resp *http.Response, release func()) *http.Response {
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp
+}
+
+// ConcurrencyLimiter 实现ConcurrencyReporter接口，返回Provider的并发限制器，未启用时返回nil
+func (p *BaseProvider) ConcurrencyLimiter() *ConcurrencyLimiter {
+	return p.concurrency
+}
@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+)
+
+// waitForQueue 等待队列长度达到n
+func waitForQueue(t *testing.T, l *ConcurrencyLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for l.Stats().QueueDepth != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待队列长度达到%d超时，当前为%d", n, l.Stats().QueueDepth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiterPriorityOrder(t *testing.T) {
+	l := NewConcurrencyLimiter(domain.ConcurrencyConfig{MaxInFlight: 1})
+	release, err := l.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("Acquire失败: %v", err)
+	}
+
+	// 依次入队，同优先级按到达顺序执行
+	waiters := []struct {
+		name     string
+		priority int
+	}{
+		{"normal-1", PriorityNormal},
+		{"interactive-1", PriorityInteractive},
+		{"normal-2", PriorityNormal},
+		{"batch", PriorityBatch},
+		{"interactive-2", PriorityInteractive},
+	}
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, w := range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(context.Background(), w.priority)
+			if err != nil {
+				t.Errorf("%s Acquire失败: %v", w.name, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, w.name)
+			mu.Unlock()
+			release()
+		}()
+		waitForQueue(t, l, i+1)
+	}
+
+	release()
+	wg.Wait()
+
+	want := []string{"interactive-1", "interactive-2", "normal-1", "normal-2", "batch"}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("执行顺序为%v，期望%v", order, want)
+		}
+	}
+	if stats := l.Stats(); stats.InFlight != 0 || stats.Queued != 5 || stats.Acquired != 6 {
+		t.Errorf("统计为%+v，期望InFlight=0、Queued=5、Acquired=6", stats)
+	}
+}
+
+func TestConcurrencyLimiterMaxQueue(t *testing.T) {
+	l := NewConcurrencyLimiter(domain.ConcurrencyConfig{MaxInFlight: 1, MaxQueue: 1})
+	release, err := l.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("Acquire失败: %v", err)
+	}
+	defer release()
+
+	go l.Acquire(context.Background(), PriorityNormal)
+	waitForQueue(t, l, 1)
+
+	_, err = l.Acquire(context.Background(), PriorityInteractive)
+	if !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("队列已满时Acquire返回%v，期望ErrConcurrencyLimit", err)
+	}
+	if stats := l.Stats(); stats.Rejected != 1 {
+		t.Errorf("Rejected为%d，期望1", stats.Rejected)
+	}
+}
+
+func TestConcurrencyLimiterCanceledWaiter(t *testing.T) {
+	l := NewConcurrencyLimiter(domain.ConcurrencyConfig{MaxInFlight: 1})
+	release, err := l.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("Acquire失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx, PriorityInteractive)
+	if !errors.Is(err, ErrConcurrencyLimit) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("排队超时返回%v，期望同时包装ErrConcurrencyLimit和DeadlineExceeded", err)
+	}
+	if stats := l.Stats(); stats.QueueDepth != 0 || stats.Canceled != 1 {
+		t.Fatalf("统计为%+v，期望取消的请求已出队", stats)
+	}
+
+	release()
+	if stats := l.Stats(); stats.InFlight != 0 {
+		t.Errorf("释放后InFlight为%d，期望0", stats.InFlight)
+	}
+}
+
+// TestConcurrencyLimiterCancelHandoff 取消与获得执行机会同时发生时（w.index == -1），执行机会转交给下一个请求
+func TestConcurrencyLimiterCancelHandoff(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		l := NewConcurrencyLimiter(domain.ConcurrencyConfig{MaxInFlight: 1})
+		release, err := l.Acquire(context.Background(), PriorityNormal)
+		if err != nil {
+			t.Fatalf("Acquire失败: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+		go func() {
+			release, err := l.Acquire(ctx, PriorityInteractive)
+			if err == nil {
+				release()
+			}
+			first <- err
+		}()
+		waitForQueue(t, l, 1)
+		second := make(chan func(), 1)
+		go func() {
+			release, err := l.Acquire(context.Background(), PriorityNormal)
+			if err != nil {
+				t.Errorf("第二个请求Acquire失败: %v", err)
+				close(second)
+				return
+			}
+			second <- release
+		}()
+		waitForQueue(t, l, 2)
+
+		// 取消与释放同时发生，第一个请求可能已出队
+		cancel()
+		release()
+		<-first
+
+		select {
+		case release, ok := <-second:
+			if !ok {
+				return
+			}
+			release()
+		case <-time.After(time.Second):
+			t.Fatalf("第%d轮: 第一个请求取消后执行机会没有转交给第二个请求", i+1)
+		}
+		if stats := l.Stats(); stats.InFlight != 0 || stats.QueueDepth != 0 {
+			t.Fatalf("第%d轮: 统计为%+v，期望InFlight=0、QueueDepth=0", i+1, stats)
+		}
+	}
+}
+
+func TestConcurrencyHeldUntilBodyClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	prov, err := NewOpenAIProvider(&domain.Platform{ID: "p", Type: "openai", BaseURL: srv.URL, APIKey: "sk-test-key"},
+		WithConcurrency(domain.ConcurrencyConfig{MaxInFlight: 1}), WithLogLevel(utils.FatalLevel))
+	if err != nil {
+		t.Fatalf("创建Provider失败: %v", err)
+	}
+	p := prov.(*OpenAIProvider)
+	limiter := p.ConcurrencyLimiter()
+
+	resp, err := p.sendRequest(context.Background(), http.MethodGet, "/models", nil, nil)
+	if err != nil {
+		t.Fatalf("sendRequest失败: %v", err)
+	}
+	if got := limiter.Stats().InFlight; got != 1 {
+		t.Fatalf("响应体关闭前InFlight为%d，期望1", got)
+	}
+	resp.Body.Close()
+	if got := limiter.Stats().InFlight; got != 0 {
+		t.Fatalf("响应体关闭后InFlight为%d，期望0", got)
+	}
+	resp.Body.Close() // 重复关闭不会重复释放
+	if got := limiter.Stats().InFlight; got != 0 {
+		t.Fatalf("重复关闭后InFlight为%d，期望0", got)
+	}
+}
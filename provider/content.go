@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// 内容片段类型
+const (
+	// ContentPartText 文本
+	ContentPartText = "text"
+	// ContentPartImage 图片，通过URL或Base64数据提供
+	ContentPartImage = "image"
+	// ContentPartDocument 文档（PDF），通过URL或Base64数据提供
+	ContentPartDocument = "document"
+)
+
+// ContentPart 多模态消息中的内容片段
+type ContentPart struct {
+	Type      string `json:"type"`                 // text, image, document
+	Text      string `json:"text,omitempty"`       // 文本内容
+	URL       string `json:"url,omitempty"`        // 图片或文档的URL
+	Data      []byte `json:"data,omitempty"`       // 图片或文档的原始数据，JSON中以Base64表示
+	MediaType string `json:"media_type,omitempty"` // 原始数据的媒体类型，如image/png、application/pdf
+}
+
+// TextPart 创建文本内容片段
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: ContentPartText, Text: text}
+}
+
+// ImageURLPart 创建通过URL引用的图片内容片段
+func ImageURLPart(url string) ContentPart {
+	return ContentPart{Type: ContentPartImage, URL: url}
+}
+
+// ImageDataPart 创建携带原始数据的图片内容片段
+func ImageDataPart(data []byte, mediaType string) ContentPart {
+	return ContentPart{Type: ContentPartImage, Data: data, MediaType: mediaType}
+}
+
+// PDFPart 创建携带原始数据的PDF文档内容片段
+func PDFPart(data []byte) ContentPart {
+	return ContentPart{Type: ContentPartDocument, Data: data, MediaType: "application/pdf"}
+}
+
+// PDFURLPart 创建通过URL引用的PDF文档内容片段
+func PDFURLPart(url string) ContentPart {
+	return ContentPart{Type: ContentPartDocument, URL: url, MediaType: "application/pdf"}
+}
+
+// dataURL 将原始数据编码为data URL
+func (c ContentPart) dataURL() string {
+	return "data:" + c.MediaType + ";base64," + base64.StdEncoding.EncodeToString(c.Data)
+}
+
+// validate 检查内容片段的有效性
+func (c ContentPart) validate() error {
+	switch c.Type {
+	case ContentPartText:
+		return nil
+	case ContentPartImage, ContentPartDocument:
+		if c.URL == "" && len(c.Data) == 0 {
+			return fmt.Errorf("%s内容片段缺少URL或数据", c.Type)
+		}
+		if len(c.Data) > 0 && c.MediaType == "" {
+			return fmt.Errorf("%s内容片段缺少媒体类型", c.Type)
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的内容片段类型: %s", c.Type)
+	}
+}
+
+// hasParts 判断消息是否使用内容片段表示
+func (m Message) hasParts() bool {
+	return len(m.Parts) > 0
+}
+
+// MarshalJSON 序列化消息，没有内容片段时content保持为字符串以兼容旧格式
+func (m Message) MarshalJSON() ([]byte, error) {
+	type alias Message
+	aux := struct {
+		alias
+		Content interface{} `json:"content"`
+	}{alias: alias(m), Content: m.Content}
+	if m.hasParts() {
+		aux.Content = m.Parts
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON 反序列化消息，content既可以是字符串也可以是内容片段数组
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type alias Message
+	aux := struct {
+		*alias
+		Content json.RawMessage `json:"content"`
+	}{alias: (*alias)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	m.Content, m.Parts = "", nil
+	raw := bytes.TrimSpace(aux.Content)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if raw[0] == '[' {
+		return json.Unmarshal(raw, &m.Parts)
+	}
+	return json.Unmarshal(raw, &m.Content)
+}
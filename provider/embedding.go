@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// 向量编码格式
+const (
+	// EncodingFormatFloat 以浮点数数组返回向量
+	EncodingFormatFloat = "float"
+	// EncodingFormatBase64 以Base64编码的float32小端字节返回向量，可减小响应体积
+	EncodingFormatBase64 = "base64"
+)
+
+// EmbeddingRequest 向量化请求
+type EmbeddingRequest struct {
+	Model          string   // 模型名称
+	Input          []string // 批量输入文本
+	Dimensions     int      // 输出向量维度，0表示使用模型默认值
+	EncodingFormat string   // 传输编码格式，见EncodingFormat*常量，为空时使用float
+}
+
+// EmbeddingResponse 向量化响应
+type EmbeddingResponse struct {
+	Model      string      // 实际响应的模型
+	Embeddings [][]float32 // 与Input一一对应的向量
+	Usage      Usage       // token用量，OutputTokens始终为0
+}
+
+// validate 检查请求的必填字段
+func (r *EmbeddingRequest) validate() error {
+	if r == nil {
+		return fmt.Errorf("请求不能为空")
+	}
+	if r.Model == "" {
+		return fmt.Errorf("请求缺少模型名称")
+	}
+	if len(r.Input) == 0 {
+		return fmt.Errorf("请求中没有输入文本")
+	}
+	if r.EncodingFormat != "" && r.EncodingFormat != EncodingFormatFloat && r.EncodingFormat != EncodingFormatBase64 {
+		return fmt.Errorf("不支持的编码格式: %s", r.EncodingFormat)
+	}
+	return nil
+}
+
+// OpenAIEmbeddingRequest OpenAI API向量化请求结构
+type OpenAIEmbeddingRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	Dimensions     int      `json:"dimensions,omitempty"`
+	EncodingFormat string   `json:"encoding_format,omitempty"`
+}
+
+// OpenAIEmbeddingResponse OpenAI API向量化响应结构
+type OpenAIEmbeddingResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int             `json:"index"`
+		Embedding json.RawMessage `json:"embedding"` // 浮点数数组或Base64字符串
+	} `json:"data"`
+	Usage *OpenAIUsage `json:"usage,omitempty"`
+	Error *Error       `json:"error,omitempty"`
+}
+
+// Embed 实现Embedder接口的Embed方法
+func (p *OpenAIProvider) Embed(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	requestBody := OpenAIEmbeddingRequest{
+		Model:          req.Model,
+		Input:          req.Input,
+		Dimensions:     req.Dimensions,
+		EncodingFormat: req.EncodingFormat,
+	}
+
+	// 按输入文本估算token数，供限流使用
+	tokens := 0
+	for _, input := range req.Input {
+		tokens += EstimateTextTokens(input)
+	}
+	ctx = withRequestInfo(ctx, req.Model, tokens, PriorityNormal)
+
+	// 发送请求
+	resp, err := p.sendRequest(ctx, "POST", "/embeddings", requestBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	var response OpenAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	// 检查错误
+	if response.Error != nil {
+		return nil, withRequestID(newAPIError(p.providerType, resp.StatusCode, response.Error), resp.Header)
+	}
+
+	// 检查响应
+	if len(response.Data) != len(req.Input) {
+		return nil, fmt.Errorf("响应中的向量数量%d与输入数量%d不一致", len(response.Data), len(req.Input))
+	}
+
+	// 按index排序，保证与输入顺序一致
+	sort.Slice(response.Data, func(i, j int) bool {
+		return response.Data[i].Index < response.Data[j].Index
+	})
+
+	embeddings := make([][]float32, 0, len(response.Data))
+	for _, item := range response.Data {
+		vector, err := decodeEmbedding(item.Embedding)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, vector)
+	}
+
+	return &EmbeddingResponse{
+		Model:      response.Model,
+		Embeddings: embeddings,
+		Usage:      response.Usage.toUsage(),
+	}, nil
+}
+
+// decodeEmbedding 解析浮点数数组或Base64编码的向量
+func decodeEmbedding(raw json.RawMessage) ([]float32, error) {
+	// 浮点数数组
+	var vector []float32
+	if err := json.Unmarshal(raw, &vector); err == nil {
+		return vector, nil
+	}
+
+	// Base64编码的float32小端字节
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return nil, fmt.Errorf("解析向量失败: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("解码Base64向量失败: %w", err)
+	}
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("Base64向量长度%d不是4的倍数", len(data))
+	}
+	vector = make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return vector, nil
+}
@@ -1,8 +1,292 @@
 package provider
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // Error API错误结构
 type Error struct {
-	Message string `json:"message"`
-	Type    string `json:"type,omitempty"`
-	Code    int    `json:"code,omitempty"`
+	Message string    `json:"message"`
+	Type    string    `json:"type,omitempty"`
+	Code    ErrorCode `json:"code,omitempty"`
+}
+
+// ErrorCode 平台返回的错误码，兼容字符串和数字两种格式
+type ErrorCode string
+
+// UnmarshalJSON 反序列化错误码
+func (c *ErrorCode) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = ErrorCode(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		*c = ErrorCode(n.String())
+		return nil
+	}
+	// null或其他格式的错误码忽略
+	*c = ""
+	return nil
+}
+
+// 错误类别，可通过errors.Is判断APIError所属类别
+var (
+	// ErrBadRequest 请求参数无效
+	ErrBadRequest = errors.New("请求参数无效")
+	// ErrAuthentication 认证失败，通常是API Key无效
+	ErrAuthentication = errors.New("认证失败")
+	// ErrPermissionDenied 没有访问权限
+	ErrPermissionDenied = errors.New("没有访问权限")
+	// ErrNotFound 资源或模型不存在
+	ErrNotFound = errors.New("资源不存在")
+	// ErrTimeout 上游请求超时
+	ErrTimeout = errors.New("上游请求超时")
+	// ErrConflict 请求冲突
+	ErrConflict = errors.New("请求冲突")
+	// ErrRateLimited 触发限流或额度不足
+	ErrRateLimited = errors.New("触发限流")
+	// ErrContextLength 输入超出模型上下文长度
+	ErrContextLength = errors.New("超出上下文长度")
+	// ErrContentFilter 内容被安全策略拦截
+	ErrContentFilter = errors.New("内容被安全策略拦截")
+	// ErrServer 上游服务内部错误
+	ErrServer = errors.New("上游服务错误")
+	// ErrOverloaded 上游服务过载
+	ErrOverloaded = errors.New("上游服务过载")
+	// ErrConnection 连接上游失败，如网络错误或连接被重置
+	ErrConnection = errors.New("连接上游失败")
+)
+
+// ErrUnsupported 平台不支持所请求的能力
+var ErrUnsupported = errors.New("平台不支持该能力")
+
+// APIError 上游平台返回的错误，包含HTTP状态码、平台错误类型和重试信息
+type APIError struct {
+	StatusCode int           // HTTP状态码，流式响应中的错误事件为0
+	Provider   string        // 平台类型，如openai、anthropic
+	Type       string        // 平台返回的错误类型
+	Code       string        // 平台返回的错误码
+	Message    string        // 错误信息
+	RequestID  string        // 上游请求ID，便于向平台反馈问题
+	RetryAfter time.Duration // 平台建议的重试等待时间，未提供时为0
+	Err        error         // 错误类别，见Err*变量
+}
+
+// Error 实现error接口
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s API错误", e.Provider)
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " (HTTP %d)", e.StatusCode)
+	}
+	if e.Type != "" {
+		fmt.Fprintf(&b, " [%s]", e.Type)
+	}
+	if e.Code != "" {
+		fmt.Fprintf(&b, " code=%s", e.Code)
+	}
+	fmt.Fprintf(&b, ": %s", e.Message)
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request_id: %s)", e.RequestID)
+	}
+	return b.String()
+}
+
+// Unwrap 返回错误类别，使errors.Is可以匹配Err*变量
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable 判断该错误是否可以重试
+func (e *APIError) Retryable() bool {
+	switch {
+	case e.Code == "insufficient_quota":
+		// 额度不足时重试没有意义
+		return false
+	case e.Err == ErrRateLimited, e.Err == ErrOverloaded, e.Err == ErrServer,
+		e.Err == ErrTimeout, e.Err == ErrConflict:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsRetryable 判断错误是否可以重试，包括连接错误、熔断器打开、客户端限流与并发限制和可重试的APIError
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrConnection) || errors.Is(err, ErrCircuitOpen) ||
+		errors.Is(err, ErrLocalRateLimit) || errors.Is(err, ErrConcurrencyLimit) {
+		return true
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Retryable()
+}
+
+// newAPIError 根据平台返回的错误信息构造APIError
+func newAPIError(providerType string, statusCode int, apiErr *Error) *APIError {
+	e := &APIError{
+		StatusCode: statusCode,
+		Provider:   providerType,
+	}
+	if apiErr != nil {
+		e.Type = apiErr.Type
+		e.Code = string(apiErr.Code)
+		e.Message = apiErr.Message
+	}
+	e.Err = classifyError(e)
+	return e
+}
+
+// newHTTPAPIError 根据非2xx的HTTP响应构造APIError
+func newHTTPAPIError(providerType string, resp *http.Response, body []byte) *APIError {
+	e := newAPIError(providerType, resp.StatusCode, parseErrorBody(body))
+	if e.Message == "" {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	e.RequestID = firstHeader(resp.Header, "x-request-id", "request-id")
+	e.RetryAfter = parseRetryAfter(resp.Header)
+	return e
+}
+
+// parseErrorBody 解析错误响应体
+// 兼容OpenAI/Anthropic的{"error": {...}}格式以及部分平台的顶层{"code": ..., "message": ...}格式
+func parseErrorBody(body []byte) *Error {
+	var wrapped struct {
+		Nested json.RawMessage `json:"error"`
+		Error
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil
+	}
+	if len(wrapped.Nested) > 0 {
+		var nested Error
+		if err := json.Unmarshal(wrapped.Nested, &nested); err == nil {
+			return &nested
+		}
+		// error字段为字符串
+		var message string
+		if err := json.Unmarshal(wrapped.Nested, &message); err == nil {
+			return &Error{Message: message}
+		}
+	}
+	if wrapped.Message != "" {
+		// 顶层的type字段在Anthropic中固定为"error"，不作为错误类型
+		e := wrapped.Error
+		if e.Type == "error" {
+			e.Type = ""
+		}
+		return &e
+	}
+	return nil
+}
+
+// classifyError 根据状态码、错误类型和错误信息判断错误类别
+func classifyError(e *APIError) error {
+	errType := strings.ToLower(e.Type)
+	code := strings.ToLower(e.Code)
+	message := strings.ToLower(e.Message)
+
+	// 优先根据错误类型和错误码判断，流式错误事件没有状态码
+	switch {
+	case errType == "overloaded_error" || e.StatusCode == 529:
+		return ErrOverloaded
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code == "context_length_exceeded" || errType == "request_too_large" ||
+		containsAny(message, "context length", "context window", "maximum context", "prompt is too long", "too many tokens"):
+		return ErrContextLength
+	case code == "content_filter" || code == "content_policy_violation" ||
+		containsAny(message, "content filter", "content management policy", "content policy", "safety system"):
+		return ErrContentFilter
+	case errType == "rate_limit_error" || code == "rate_limit_exceeded" || code == "insufficient_quota":
+		return ErrRateLimited
+	case errType == "authentication_error" || code == "invalid_api_key":
+		return ErrAuthentication
+	case errType == "permission_error":
+		return ErrPermissionDenied
+	case errType == "not_found_error" || code == "model_not_found":
+		return ErrNotFound
+	case errType == "api_error" || errType == "server_error":
+		return ErrServer
+	}
+
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrAuthentication
+	case e.StatusCode == http.StatusForbidden:
+		return ErrPermissionDenied
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusRequestTimeout:
+		return ErrTimeout
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode == http.StatusRequestEntityTooLarge:
+		return ErrContextLength
+	case e.StatusCode == http.StatusServiceUnavailable:
+		return ErrOverloaded
+	case e.StatusCode >= 500:
+		return ErrServer
+	default:
+		return ErrBadRequest
+	}
+}
+
+// parseRetryAfter 解析retry-after-ms与Retry-After响应头
+func parseRetryAfter(header http.Header) time.Duration {
+	if v := header.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+		}
+	}
+	return 0
+}
+
+// withRequestID 为缺少上游请求ID的APIError补充请求ID
+func withRequestID(err error, header http.Header) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RequestID == "" {
+		apiErr.RequestID = firstHeader(header, "x-request-id", "request-id")
+	}
+	return err
+}
+
+// firstHeader 返回第一个非空的响应头
+func firstHeader(header http.Header, keys ...string) string {
+	for _, key := range keys {
+		if v := header.Get(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// containsAny 判断s是否包含任意一个子串
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseErrorBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *Error
+	}{
+		{
+			"openai",
+			`{"error":{"message":"Incorrect API key provided: sk-abc***xyz.","type":"invalid_request_error","param":null,"code":"invalid_api_key"}}`,
+			&Error{Message: "Incorrect API key provided: sk-abc***xyz.", Type: "invalid_request_error", Code: "invalid_api_key"},
+		},
+		{
+			"openai_null_type",
+			`{"error":{"message":"The response was filtered","type":null,"param":"prompt","code":"content_filter","status":400}}`,
+			&Error{Message: "The response was filtered", Code: "content_filter"},
+		},
+		{
+			"anthropic",
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			&Error{Message: "Overloaded", Type: "overloaded_error"},
+		},
+		{
+			"siliconflow_number_code",
+			`{"code":20012,"message":"Model does not exist. Please check it carefully.","data":null}`,
+			&Error{Message: "Model does not exist. Please check it carefully.", Code: "20012"},
+		},
+		{
+			"string_error",
+			`{"error":"Unauthorized"}`,
+			&Error{Message: "Unauthorized"},
+		},
+		{"plain_text", `Invalid token`, nil},
+		{"empty_object", `{}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseErrorBody([]byte(tt.body))
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("解析结果为%+v，期望%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPAPIError(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		status    int
+		body      string
+		want      error
+		retryable bool
+		message   string
+	}{
+		// OpenAI
+		{"openai_invalid_key", "openai", 401,
+			`{"error":{"message":"Incorrect API key provided: sk-abc***xyz.","type":"invalid_request_error","param":null,"code":"invalid_api_key"}}`,
+			ErrAuthentication, false, "Incorrect API key provided: sk-abc***xyz."},
+		{"openai_rate_limit", "openai", 429,
+			`{"error":{"message":"Rate limit reached for gpt-4o on requests per min (RPM): Limit 500, Used 500, Requested 1.","type":"requests","param":null,"code":"rate_limit_exceeded"}}`,
+			ErrRateLimited, true, ""},
+		{"openai_insufficient_quota", "openai", 429,
+			`{"error":{"message":"You exceeded your current quota, please check your plan and billing details.","type":"insufficient_quota","param":null,"code":"insufficient_quota"}}`,
+			ErrRateLimited, false, ""},
+		{"openai_context_length", "openai", 400,
+			`{"error":{"message":"This model's maximum context length is 8192 tokens. However, your messages resulted in 9000 tokens.","type":"invalid_request_error","param":"messages","code":"context_length_exceeded"}}`,
+			ErrContextLength, false, ""},
+		{"openai_model_not_found", "openai", 404,
+			"{\"error\":{\"message\":\"The model `gpt-5` does not exist or you do not have access to it.\",\"type\":\"invalid_request_error\",\"param\":null,\"code\":\"model_not_found\"}}",
+			ErrNotFound, false, ""},
+		{"azure_content_filter", "openai", 400,
+			`{"error":{"message":"The response was filtered due to the prompt triggering Azure OpenAI's content management policy.","type":null,"param":"prompt","code":"content_filter","status":400}}`,
+			ErrContentFilter, false, ""},
+		{"openai_server_error", "openai", 500,
+			`{"error":{"message":"The server had an error while processing your request. Sorry about that!","type":"server_error","param":null,"code":null}}`,
+			ErrServer, true, ""},
+
+		// Anthropic
+		{"anthropic_authentication", "anthropic", 401,
+			`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			ErrAuthentication, false, "invalid x-api-key"},
+		{"anthropic_permission", "anthropic", 403,
+			`{"type":"error","error":{"type":"permission_error","message":"Your API key does not have permission to use the specified resource."}}`,
+			ErrPermissionDenied, false, ""},
+		{"anthropic_prompt_too_long", "anthropic", 400,
+			`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`,
+			ErrContextLength, false, ""},
+		{"anthropic_rate_limit", "anthropic", 429,
+			`{"type":"error","error":{"type":"rate_limit_error","message":"Number of request tokens has exceeded your per-minute rate limit"}}`,
+			ErrRateLimited, true, ""},
+		{"anthropic_api_error", "anthropic", 500,
+			`{"type":"error","error":{"type":"api_error","message":"Internal server error"}}`,
+			ErrServer, true, ""},
+		{"anthropic_overloaded", "anthropic", 529,
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			ErrOverloaded, true, "Overloaded"},
+
+		// SiliconFlow，错误码为数字
+		{"siliconflow_model_not_exist", "openai", 400,
+			`{"code":20012,"message":"Model does not exist. Please check it carefully.","data":null}`,
+			ErrBadRequest, false, "Model does not exist. Please check it carefully."},
+		{"siliconflow_busy", "openai", 429,
+			`{"code":50603,"message":"System is too busy now. Please try again later.","data":null}`,
+			ErrRateLimited, true, ""},
+		{"siliconflow_plain_text", "openai", 401, `Invalid token`, ErrAuthentication, false, "Invalid token"},
+
+		// 非标准响应
+		{"string_error", "openai", 401, `{"error":"Unauthorized"}`, ErrAuthentication, false, "Unauthorized"},
+		{"empty_body", "openai", 503, ``, ErrOverloaded, true, "Service Unavailable"},
+		{"request_timeout", "openai", 408, ``, ErrTimeout, true, ""},
+		{"conflict", "openai", 409, ``, ErrConflict, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			resp.Header.Set("x-request-id", "req_123")
+			err := newHTTPAPIError(tt.provider, resp, []byte(tt.body))
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("错误类别为%v，期望%v", err.Err, tt.want)
+			}
+			if err.Retryable() != tt.retryable || IsRetryable(err) != tt.retryable {
+				t.Errorf("Retryable为%v，期望%v", err.Retryable(), tt.retryable)
+			}
+			if tt.message != "" && err.Message != tt.message {
+				t.Errorf("错误信息为%q，期望%q", err.Message, tt.message)
+			}
+			if err.StatusCode != tt.status || err.Provider != tt.provider || err.RequestID != "req_123" {
+				t.Errorf("APIError为%+v，状态码、平台或请求ID不正确", err)
+			}
+		})
+	}
+}
+
+// TestClassifyStreamError 流式错误事件没有状态码，按错误类型判断
+func TestClassifyStreamError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *Error
+		want error
+	}{
+		{"overloaded", &Error{Type: "overloaded_error", Message: "Overloaded"}, ErrOverloaded},
+		{"server_error", &Error{Type: "server_error", Message: "internal error"}, ErrServer},
+		{"rate_limit", &Error{Type: "rate_limit_error", Message: "slow down"}, ErrRateLimited},
+		{"unknown", &Error{Message: "something happened"}, ErrBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newAPIError("anthropic", 0, tt.err); !errors.Is(err, tt.want) {
+				t.Errorf("错误类别为%v，期望%v", err.Err, tt.want)
+			}
+		})
+	}
+}
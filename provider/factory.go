@@ -31,3 +31,35 @@ func CreateProvider(platform *domain.Platform, options ...ProviderOption) (AIPro
 	// 使用工厂函数创建Provider实例
 	return factory(platform, options...)
 }
+
+// CreateEmbedder 根据平台配置创建支持向量化的Provider实例
+func CreateEmbedder(platform *domain.Platform, options ...ProviderOption) (Embedder, error) {
+	prov, err := CreateProvider(platform, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	embedder, ok := prov.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("平台类型 %s 不支持向量化: %w", platform.Type, ErrUnsupported)
+	}
+	return embedder, nil
+}
+
+// CreateReranker 根据平台配置创建支持重排序的Provider实例，平台需在capabilities中声明rerank
+func CreateReranker(platform *domain.Platform, options ...ProviderOption) (Reranker, error) {
+	if !platform.HasCapability(domain.CapabilityRerank) {
+		return nil, fmt.Errorf("平台 %s 未声明rerank能力: %w", platform.ID, ErrUnsupported)
+	}
+
+	prov, err := CreateProvider(platform, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	reranker, ok := prov.(Reranker)
+	if !ok {
+		return nil, fmt.Errorf("平台类型 %s 不支持重排序: %w", platform.Type, ErrUnsupported)
+	}
+	return reranker, nil
+}
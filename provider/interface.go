@@ -2,28 +2,56 @@ package provider
 
 import "context"
 
+// 消息角色
+const (
+	// RoleSystem 系统提示
+	RoleSystem = "system"
+	// RoleUser 用户
+	RoleUser = "user"
+	// RoleAssistant 助手
+	RoleAssistant = "assistant"
+	// RoleTool 工具调用结果
+	RoleTool = "tool"
+)
+
 // Message 消息结构
 type Message struct {
-	Role    string `json:"role"`    // user, assistant, system
-	Content string `json:"content"` // 消息内容
+	Role       string        `json:"role"`                   // user, assistant, system, tool
+	Content    string        `json:"content"`                // 消息内容
+	Parts      []ContentPart `json:"-"`                      // 多模态内容片段，非空时取代Content
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`   // 助手发起的工具调用
+	ToolCallID string        `json:"tool_call_id,omitempty"` // 工具结果消息对应的工具调用ID
 }
 
 // AIProvider 定义了AI提供商的统一接口
 type AIProvider interface {
+	// Do 发送统一结构的聊天请求并获取完整响应
+	// ctx: 上下文，用于控制请求超时等
+	// req: 聊天请求，包含模型、消息历史和生成参数
+	// 返回值: 统一结构的响应和可能的错误
+	Do(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+
+	// DoStream 发送统一结构的聊天请求并以事件形式流式获取回复
+	// ctx: 上下文，用于控制请求超时等
+	// req: 聊天请求，包含模型、消息历史和生成参数
+	// callback: 回调函数，用于处理每一个流式事件，token用量在流结束时以事件形式发送
+	// 返回值: 可能的错误
+	DoStream(ctx context.Context, req *ChatRequest, callback func(event StreamEvent) error) error
+
 	// Chat 发送聊天请求并获取回复
 	// ctx: 上下文，用于控制请求超时等
 	// model: 模型名称
 	// msg: 用户输入的消息
 	// 返回值: 模型的回复和可能的错误
 	Chat(ctx context.Context, model string, msg string) (string, error)
-	
+
 	// ChatWithContext 发送带上下文的聊天请求并获取回复
 	// ctx: 上下文，用于控制请求超时等
 	// model: 模型名称
 	// messages: 消息历史，包含用户和助手的对话
 	// 返回值: 模型的回复和可能的错误
 	ChatWithContext(ctx context.Context, model string, messages []Message) (string, error)
-	
+
 	// ChatStream 发送聊天请求并流式获取回复
 	// ctx: 上下文，用于控制请求超时等
 	// model: 模型名称
@@ -31,7 +59,7 @@ type AIProvider interface {
 	// callback: 回调函数，用于处理流式输出的每一个 chunk
 	// 返回值: 可能的错误
 	ChatStream(ctx context.Context, model string, msg string, callback func(chunk string) error) error
-	
+
 	// ChatStreamWithContext 发送带上下文的聊天请求并流式获取回复
 	// ctx: 上下文，用于控制请求超时等
 	// model: 模型名称
@@ -40,3 +68,29 @@ type AIProvider interface {
 	// 返回值: 可能的错误
 	ChatStreamWithContext(ctx context.Context, model string, messages []Message, callback func(chunk string) error) error
 }
+
+// Embedder 定义了向量化能力，CreateProvider返回的实例可通过类型断言获取
+type Embedder interface {
+	// Embed 批量将文本转换为向量
+	// ctx: 上下文，用于控制请求超时等
+	// req: 向量化请求，包含模型、批量输入、维度和编码格式
+	// 返回值: 与输入一一对应的向量和可能的错误
+	Embed(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error)
+}
+
+// Reranker 定义了重排序能力，仅声明了rerank能力的平台可用
+type Reranker interface {
+	// Rerank 根据查询对文档进行相关性重排序
+	// ctx: 上下文，用于控制请求超时等
+	// req: 重排序请求，包含模型、查询、文档和返回数量
+	// 返回值: 按相关性分数降序排列的结果和可能的错误
+	Rerank(ctx context.Context, req *RerankRequest) (*RerankResponse, error)
+}
+
+// ModelLister 定义了模型发现能力
+type ModelLister interface {
+	// ListModels 从平台的模型列表接口获取当前可用的模型
+	// ctx: 上下文，用于控制请求超时等
+	// 返回值: 归一化的模型元数据和可能的错误
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cn-maul/Baize/pkg/utils"
+)
+
+// Key选择策略
+const (
+	// KeySelectionRoundRobin 轮询使用各个Key
+	KeySelectionRoundRobin = "round_robin"
+	// KeySelectionLeastThrottled 优先使用最久未被限流的Key
+	KeySelectionLeastThrottled = "least_throttled"
+)
+
+const (
+	// throttledKeyBenchDuration Key被限流且上游未提供Retry-After时的暂停时间
+	throttledKeyBenchDuration = 30 * time.Second
+	// invalidKeyBenchDuration Key认证失败或额度不足时的暂停时间
+	invalidKeyBenchDuration = 5 * time.Minute
+)
+
+// KeyHealth 单个API Key的健康状况
+type KeyHealth struct {
+	Key           string    // 脱敏后的Key
+	Available     bool      // 当前是否可用，被暂停的Key为false
+	BenchedUntil  time.Time // 暂停截止时间
+	Requests      int64     // 请求次数
+	Throttled     int64     // 被限流次数
+	AuthFailures  int64     // 认证失败次数
+	LastThrottled time.Time // 最近一次被限流的时间
+	LastError     string    // 最近一次导致暂停的错误
+}
+
+// KeyHealthReporter 定义了上报API Key健康状况的能力，CreateProvider返回的实例可通过类型断言获取
+type KeyHealthReporter interface {
+	// KeyHealth 返回平台各个API Key的健康状况，顺序与配置一致
+	KeyHealth() []KeyHealth
+}
+
+// keyPool 平台的API Key池，按选择策略分配Key，并在401/429后暂时停用对应的Key
+type keyPool struct {
+	mu        sync.Mutex
+	keys      []*keyState
+	selection string
+	next      int
+}
+
+// keyState 单个Key的状态
+type keyState struct {
+	key string
+	KeyHealth
+}
+
+// newKeyPool 创建Key池，selection为空时使用轮询
+func newKeyPool(keys []string, selection string) *keyPool {
+	if selection == "" {
+		selection = KeySelectionRoundRobin
+	}
+	pool := &keyPool{selection: selection}
+	for _, key := range keys {
+		pool.keys = append(pool.keys, &keyState{key: key, KeyHealth: KeyHealth{Key: utils.MaskAPIKey(key)}})
+	}
+	return pool
+}
+
+// acquire 选择一个Key，所有Key都被暂停时返回最早恢复的Key
+func (p *keyPool) acquire() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.keys) == 0 {
+		return ""
+	}
+
+	now := time.Now()
+	var chosen *keyState
+	chosenIndex := -1
+	for i := 0; i < len(p.keys); i++ {
+		index := (p.next + i) % len(p.keys)
+		k := p.keys[index]
+		if k.BenchedUntil.After(now) {
+			continue
+		}
+		if chosen == nil || (p.selection == KeySelectionLeastThrottled && k.LastThrottled.Before(chosen.LastThrottled)) {
+			chosen, chosenIndex = k, index
+		}
+		if p.selection != KeySelectionLeastThrottled {
+			break
+		}
+	}
+
+	if chosen == nil {
+		for index, k := range p.keys {
+			if chosen == nil || k.BenchedUntil.Before(chosen.BenchedUntil) {
+				chosen, chosenIndex = k, index
+			}
+		}
+	}
+
+	p.next = (chosenIndex + 1) % len(p.keys)
+	chosen.Requests++
+	return chosen.key
+}
+
+// isKeyFailure 判断错误是否由Key本身导致，即限流或认证失败
+func isKeyFailure(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrAuthentication)
+}
+
+// size 返回Key池中Key的总数
+func (p *keyPool) size() int {
+	return len(p.keys)
+}
+
+// available 返回当前未被暂停的Key数量
+func (p *keyPool) available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, k := range p.keys {
+		if !k.BenchedUntil.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// report 根据请求结果更新Key的状态，限流和认证失败的Key会被暂停
+func (p *keyPool) report(key string, err error) {
+	if err == nil || !isKeyFailure(err) {
+		return
+	}
+	throttled := errors.Is(err, ErrRateLimited)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, k := range p.keys {
+		if k.key != key {
+			continue
+		}
+		now := time.Now()
+		bench := invalidKeyBenchDuration
+		if throttled {
+			k.Throttled++
+			k.LastThrottled = now
+			var apiErr *APIError
+			switch {
+			case errors.As(err, &apiErr) && apiErr.Code == "insufficient_quota":
+				// 额度不足短时间内不会恢复
+			case errors.As(err, &apiErr) && apiErr.RetryAfter > 0:
+				bench = apiErr.RetryAfter
+			default:
+				bench = throttledKeyBenchDuration
+			}
+		} else {
+			k.AuthFailures++
+		}
+		k.BenchedUntil = now.Add(bench)
+		k.LastError = err.Error()
+		return
+	}
+}
+
+// health 返回各个Key的健康状况
+func (p *keyPool) health() []KeyHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	health := make([]KeyHealth, 0, len(p.keys))
+	for _, k := range p.keys {
+		h := k.KeyHealth
+		h.Available = !h.BenchedUntil.After(now)
+		health = append(health, h)
+	}
+	return health
+}
@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+)
+
+// acquireN 连续选择n次Key
+func acquireN(p *keyPool, n int) []string {
+	keys := make([]string, 0, n)
+	for range n {
+		keys = append(keys, p.acquire())
+	}
+	return keys
+}
+
+func TestKeyPoolSelection(t *testing.T) {
+	keys := []string{"k1", "k2", "k3"}
+
+	roundRobin := newKeyPool(keys, "")
+	if got := acquireN(roundRobin, 4); !slices.Equal(got, []string{"k1", "k2", "k3", "k1"}) {
+		t.Errorf("轮询选择的Key为%v，期望[k1 k2 k3 k1]", got)
+	}
+
+	// least_throttled优先使用最久未被限流的Key
+	leastThrottled := newKeyPool(keys, KeySelectionLeastThrottled)
+	now := time.Now()
+	leastThrottled.keys[0].LastThrottled = now.Add(-time.Minute)
+	leastThrottled.keys[1].LastThrottled = now.Add(-time.Hour)
+	leastThrottled.keys[2].LastThrottled = now
+	if got := acquireN(leastThrottled, 3); !slices.Equal(got, []string{"k2", "k2", "k2"}) {
+		t.Errorf("least_throttled选择的Key为%v，期望[k2 k2 k2]", got)
+	}
+
+	// 被暂停的Key不参与选择
+	roundRobin.keys[1].BenchedUntil = now.Add(time.Minute)
+	if got := acquireN(roundRobin, 3); !slices.Equal(got, []string{"k3", "k1", "k3"}) {
+		t.Errorf("k2暂停后轮询选择的Key为%v，期望[k3 k1 k3]", got)
+	}
+}
+
+func TestKeyPoolBenchDuration(t *testing.T) {
+	rateLimited := func(code string, retryAfter time.Duration) error {
+		return &APIError{StatusCode: 429, Code: code, RetryAfter: retryAfter, Err: ErrRateLimited}
+	}
+	tests := []struct {
+		name  string
+		err   error
+		bench time.Duration
+	}{
+		{"retry_after", rateLimited("rate_limit_exceeded", 7*time.Second), 7 * time.Second},
+		{"default_throttle", rateLimited("rate_limit_exceeded", 0), throttledKeyBenchDuration},
+		{"insufficient_quota", rateLimited("insufficient_quota", 7*time.Second), invalidKeyBenchDuration},
+		{"authentication", &APIError{StatusCode: 401, Err: ErrAuthentication}, invalidKeyBenchDuration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newKeyPool([]string{"sk-test-key-1", "sk-test-key-2"}, "")
+			before := time.Now()
+			p.report("sk-test-key-1", tt.err)
+			health := p.health()[0]
+			if health.Available {
+				t.Fatal("Key报告失败后仍可用")
+			}
+			if bench := health.BenchedUntil.Sub(before); bench < tt.bench || bench > tt.bench+time.Second {
+				t.Errorf("Key暂停了%v，期望%v", bench, tt.bench)
+			}
+			if p.available() != 1 {
+				t.Errorf("可用Key数为%d，期望1", p.available())
+			}
+		})
+	}
+
+	// 与Key无关的错误不暂停Key
+	p := newKeyPool([]string{"sk-test-key-1"}, "")
+	p.report("sk-test-key-1", &APIError{StatusCode: 500, Err: ErrServer})
+	if !p.health()[0].Available {
+		t.Error("服务端错误导致Key被暂停")
+	}
+}
+
+func TestKeyPoolAllBenched(t *testing.T) {
+	p := newKeyPool([]string{"k1", "k2", "k3"}, "")
+	now := time.Now()
+	p.keys[0].BenchedUntil = now.Add(3 * time.Minute)
+	p.keys[1].BenchedUntil = now.Add(time.Minute)
+	p.keys[2].BenchedUntil = now.Add(2 * time.Minute)
+
+	// 所有Key都被暂停时使用最早恢复的Key
+	if got := acquireN(p, 2); !slices.Equal(got, []string{"k2", "k2"}) {
+		t.Errorf("选择的Key为%v，期望[k2 k2]", got)
+	}
+	if p.available() != 0 {
+		t.Errorf("可用Key数为%d，期望0", p.available())
+	}
+}
+
+// TestKeySwitchCap 每次调用最多换Key size-1 次，即使Key的暂停时间很短也不会无限换Key
+func TestKeySwitchCap(t *testing.T) {
+	var mu sync.Mutex
+	var used []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		used = append(used, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		mu.Unlock()
+		w.Header().Set("retry-after-ms", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"rate limited","type":"requests","code":"rate_limit_exceeded"}}`))
+	}))
+	defer srv.Close()
+
+	platform := &domain.Platform{ID: "p", Type: "openai", BaseURL: srv.URL, APIKey: "sk-key-1", APIKeys: []string{"sk-key-2", "sk-key-3"}}
+	prov, err := NewOpenAIProvider(platform, WithMaxRetries(0), WithLogLevel(utils.FatalLevel))
+	if err != nil {
+		t.Fatalf("创建Provider失败: %v", err)
+	}
+
+	_, err = prov.Chat(context.Background(), "m", "hi")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Chat返回%v，期望ErrRateLimited", err)
+	}
+	if !slices.Equal(used, []string{"sk-key-1", "sk-key-2", "sk-key-3"}) {
+		t.Errorf("依次使用的Key为%v，期望每个Key各尝试一次", used)
+	}
+}
@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+// ModelInfo 归一化的模型元数据
+type ModelInfo struct {
+	ID          string    // 模型名称，即调用时使用的model
+	DisplayName string    // 展示名称，平台未提供时为空
+	OwnedBy     string    // 模型所属组织，平台未提供时为空
+	CreatedAt   time.Time // 模型发布时间，平台未提供时为零值
+}
+
+// OpenAIModelList OpenAI API模型列表响应结构
+type OpenAIModelList struct {
+	Data []struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	} `json:"data"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// AnthropicModelList Anthropic API模型列表响应结构
+type AnthropicModelList struct {
+	Data []struct {
+		ID          string    `json:"id"`
+		DisplayName string    `json:"display_name"`
+		CreatedAt   time.Time `json:"created_at"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastID  string `json:"last_id"`
+	Error   *Error `json:"error,omitempty"`
+}
+
+// anthropicModelPageSize Anthropic模型列表每页数量（接口允许的最大值）
+const anthropicModelPageSize = 1000
+
+// ListModels 实现ModelLister接口，调用GET /models
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	// 模型列表请求不属于任何模型，也不消耗token
+	ctx = withRequestInfo(ctx, "", 0, PriorityNormal)
+
+	// 发送请求
+	resp, err := p.sendRequest(ctx, "GET", "/models", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	var response OpenAIModelList
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	// 检查错误
+	if response.Error != nil {
+		return nil, withRequestID(newAPIError(p.providerType, resp.StatusCode, response.Error), resp.Header)
+	}
+
+	models := make([]ModelInfo, 0, len(response.Data))
+	for _, m := range response.Data {
+		info := ModelInfo{ID: m.ID, OwnedBy: m.OwnedBy}
+		if m.Created > 0 {
+			info.CreatedAt = time.Unix(m.Created, 0)
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// ListModels 实现ModelLister接口，分页调用GET /v1/models直到取完全部模型
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	// 模型列表请求不属于任何模型，也不消耗token
+	ctx = withRequestInfo(ctx, "", 0, PriorityNormal)
+
+	var models []ModelInfo
+	afterID := ""
+
+	for {
+		query := url.Values{}
+		query.Set("limit", fmt.Sprint(anthropicModelPageSize))
+		if afterID != "" {
+			query.Set("after_id", afterID)
+		}
+
+		// 发送请求
+		resp, err := p.sendRequest(ctx, "GET", "/v1/models?"+query.Encode(), nil, p.headers())
+		if err != nil {
+			return nil, err
+		}
+
+		// 解析响应
+		var response AnthropicModelList
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析响应失败: %w", err)
+		}
+
+		// 检查错误
+		if response.Error != nil {
+			return nil, withRequestID(newAPIError(p.providerType, resp.StatusCode, response.Error), resp.Header)
+		}
+
+		for _, m := range response.Data {
+			models = append(models, ModelInfo{
+				ID:          m.ID,
+				DisplayName: m.DisplayName,
+				CreatedAt:   m.CreatedAt,
+			})
+		}
+
+		// 没有更多数据或游标未推进时结束，避免死循环
+		if !response.HasMore || response.LastID == "" || response.LastID == afterID {
+			return models, nil
+		}
+		afterID = response.LastID
+	}
+}
+
+// ModelDiscoverer 返回用于config.WithModelDiscovery的模型发现函数
+// 该函数为每个平台创建Provider并调用ListModels，返回模型名称列表
+func ModelDiscoverer(ctx context.Context, options ...ProviderOption) func(platform *domain.Platform) ([]string, error) {
+	return func(platform *domain.Platform) ([]string, error) {
+		prov, err := CreateProvider(platform, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		lister, ok := prov.(ModelLister)
+		if !ok {
+			return nil, fmt.Errorf("平台类型 %s 不支持模型发现: %w", platform.Type, ErrUnsupported)
+		}
+
+		models, err := lister.ListModels(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, 0, len(models))
+		for _, m := range models {
+			names = append(names, m.ID)
+		}
+		return names, nil
+	}
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+)
+
+// anthropicModelPage 模拟的模型列表分页
+type anthropicModelPage struct {
+	ids     []string
+	hasMore bool
+	lastID  string
+}
+
+// newAnthropicModelsProvider 创建按after_id返回pages中分页的AnthropicProvider，并记录每次请求的after_id
+func newAnthropicModelsProvider(t *testing.T, pages map[string]anthropicModelPage) (ModelLister, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var afterIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.URL.Query().Get("limit") != "1000" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("请求为%s，缺少分页参数或anthropic-version", r.URL)
+		}
+		afterID := r.URL.Query().Get("after_id")
+		mu.Lock()
+		afterIDs = append(afterIDs, afterID)
+		mu.Unlock()
+
+		page, ok := pages[afterID]
+		if !ok {
+			t.Errorf("请求了不存在的分页after_id=%q", afterID)
+		}
+		data := ""
+		for i, id := range page.ids {
+			if i > 0 {
+				data += ","
+			}
+			data += fmt.Sprintf(`{"type":"model","id":%q,"display_name":%q,"created_at":"2025-05-22T00:00:00Z"}`, id, id)
+		}
+		fmt.Fprintf(w, `{"data":[%s],"has_more":%t,"first_id":null,"last_id":%q}`, data, page.hasMore, page.lastID)
+	}))
+	t.Cleanup(srv.Close)
+
+	prov, err := NewAnthropicProvider(&domain.Platform{ID: "anthropic", Type: "anthropic", BaseURL: srv.URL, APIKey: "sk-ant-test-key"},
+		WithLogLevel(utils.FatalLevel))
+	if err != nil {
+		t.Fatalf("创建Provider失败: %v", err)
+	}
+	return prov.(ModelLister), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return afterIDs
+	}
+}
+
+func TestAnthropicListModelsPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		pages    map[string]anthropicModelPage
+		models   []string
+		afterIDs []string
+	}{
+		{
+			"has_more",
+			map[string]anthropicModelPage{
+				"":                  {ids: []string{"claude-opus-4", "claude-sonnet-4"}, hasMore: true, lastID: "claude-sonnet-4"},
+				"claude-sonnet-4":   {ids: []string{"claude-3-7-sonnet"}, hasMore: true, lastID: "claude-3-7-sonnet"},
+				"claude-3-7-sonnet": {ids: []string{"claude-3-5-haiku"}, hasMore: false, lastID: "claude-3-5-haiku"},
+			},
+			[]string{"claude-opus-4", "claude-sonnet-4", "claude-3-7-sonnet", "claude-3-5-haiku"},
+			[]string{"", "claude-sonnet-4", "claude-3-7-sonnet"},
+		},
+		{
+			// 游标没有推进时结束，避免死循环
+			"stuck_cursor",
+			map[string]anthropicModelPage{
+				"":                {ids: []string{"claude-sonnet-4"}, hasMore: true, lastID: "claude-sonnet-4"},
+				"claude-sonnet-4": {ids: []string{"claude-sonnet-4"}, hasMore: true, lastID: "claude-sonnet-4"},
+			},
+			[]string{"claude-sonnet-4", "claude-sonnet-4"},
+			[]string{"", "claude-sonnet-4"},
+		},
+		{
+			"empty_last_id",
+			map[string]anthropicModelPage{
+				"": {ids: []string{}, hasMore: true},
+			},
+			nil,
+			[]string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lister, afterIDs := newAnthropicModelsProvider(t, tt.pages)
+			models, err := lister.ListModels(context.Background())
+			if err != nil {
+				t.Fatalf("ListModels失败: %v", err)
+			}
+			var ids []string
+			for _, m := range models {
+				ids = append(ids, m.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.models) {
+				t.Errorf("模型为%v，期望%v", ids, tt.models)
+			}
+			if got := afterIDs(); !reflect.DeepEqual(got, tt.afterIDs) {
+				t.Errorf("请求的after_id依次为%q，期望%q", got, tt.afterIDs)
+			}
+		})
+	}
+}
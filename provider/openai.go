@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 
 	"github.com/cn-maul/Baize/domain"
@@ -18,177 +19,401 @@ type OpenAIProvider struct {
 
 // NewOpenAIProvider 创建新的OpenAIProvider实例
 func NewOpenAIProvider(platform *domain.Platform, options ...ProviderOption) (AIProvider, error) {
+	base := NewBaseProvider(platform.BaseURL, platform.APIKey, options...)
+	base.providerType = "openai"
+	base.setPlatform(platform)
+	base.authorize = func(header http.Header, key string) {
+		header.Set("Authorization", "Bearer "+key)
+	}
 	return &OpenAIProvider{
-		BaseProvider: NewBaseProvider(platform.BaseURL, platform.APIKey, options...),
+		BaseProvider: base,
 	}, nil
 }
 
 // OpenAIRequest OpenAI API请求结构
 type OpenAIRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream,omitempty"`
+	Model            string               `json:"model"`
+	Messages         []OpenAIMessage      `json:"messages"`
+	Stream           bool                 `json:"stream,omitempty"`
+	Temperature      *float64             `json:"temperature,omitempty"`
+	TopP             *float64             `json:"top_p,omitempty"`
+	MaxTokens        int                  `json:"max_tokens,omitempty"`
+	Stop             []string             `json:"stop,omitempty"`
+	Seed             *int64               `json:"seed,omitempty"`
+	PresencePenalty  *float64             `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64             `json:"frequency_penalty,omitempty"`
+	StreamOptions    *OpenAIStreamOptions `json:"stream_options,omitempty"`
+	Tools            []OpenAITool         `json:"tools,omitempty"`
+	ToolChoice       interface{}          `json:"tool_choice,omitempty"`
+}
+
+// OpenAIMessage OpenAI API消息结构
+type OpenAIMessage struct {
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// OpenAIContentPart OpenAI API消息内容片段
+type OpenAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *OpenAIImageURL `json:"image_url,omitempty"`
+	File     *OpenAIFile     `json:"file,omitempty"`
+}
+
+// OpenAIImageURL OpenAI API图片引用，URL可以是data URL
+type OpenAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// OpenAIFile OpenAI API文件内容
+type OpenAIFile struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+}
+
+// OpenAIResponseMessage OpenAI API响应中的消息结构
+type OpenAIResponseMessage struct {
+	Role             string           `json:"role"`
+	Content          string           `json:"content"`
+	ReasoningContent string           `json:"reasoning_content,omitempty"` // DeepSeek等平台返回的推理内容
+	ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
+}
+
+// OpenAITool OpenAI API工具定义
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+// OpenAIFunction OpenAI API函数定义
+type OpenAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// OpenAIToolCall OpenAI API工具调用结构，流式响应中通过Index关联增量
+type OpenAIToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
+}
+
+// OpenAIStreamOptions OpenAI流式请求选项
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// OpenAIUsage OpenAI API用量结构
+type OpenAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+}
+
+// toUsage 将OpenAI用量转换为归一化的Usage
+func (u *OpenAIUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	usage := Usage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CachedTokens = u.PromptTokensDetails.CachedTokens
+	}
+	if u.CompletionTokensDetails != nil {
+		usage.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	return usage
 }
 
 // OpenAIResponse OpenAI API响应结构
 type OpenAIResponse struct {
-	Choices []Choice `json:"choices"`
-	Error   *Error   `json:"error,omitempty"`
+	ID      string       `json:"id"`
+	Model   string       `json:"model"`
+	Choices []Choice     `json:"choices"`
+	Usage   *OpenAIUsage `json:"usage,omitempty"`
+	Error   *Error       `json:"error,omitempty"`
 }
 
 // OpenAIStreamResponse OpenAI API流式响应结构
 type OpenAIStreamResponse struct {
+	ID      string         `json:"id"`
+	Model   string         `json:"model"`
 	Choices []StreamChoice `json:"choices"`
+	Usage   *OpenAIUsage   `json:"usage,omitempty"`
 	Error   *Error         `json:"error,omitempty"`
 }
 
 // StreamChoice 流式选择结构
 type StreamChoice struct {
-	Delta        Message `json:"delta"`
-	FinishReason string  `json:"finish_reason"`
+	Delta        OpenAIResponseMessage `json:"delta"`
+	FinishReason string                `json:"finish_reason"`
 }
 
 // Choice 选择结构
 type Choice struct {
-	Message Message `json:"message"`
+	Message      OpenAIResponseMessage `json:"message"`
+	FinishReason string                `json:"finish_reason"`
 }
 
-// Chat 实现AIProvider接口的Chat方法
-func (p *OpenAIProvider) Chat(ctx context.Context, model string, msg string) (string, error) {
-	// 构建请求体
+// newOpenAIRequest 将统一的ChatRequest映射为OpenAI请求体
+func newOpenAIRequest(req *ChatRequest, stream bool) (OpenAIRequest, error) {
 	requestBody := OpenAIRequest{
-		Model: model,
-		Messages: []Message{
-			{Role: "user", Content: msg},
-		},
+		Model:            req.Model,
+		Messages:         make([]OpenAIMessage, 0, len(req.Messages)),
+		Stream:           stream,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxTokens:        req.MaxTokens,
+		Stop:             req.Stop,
+		Seed:             req.Seed,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+	}
+	// 流式请求要求平台在最后一个chunk中返回用量
+	if stream {
+		requestBody.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
 	}
 
-	// 设置请求头
-	headers := map[string]string{
-		"Authorization": "Bearer " + p.apiKey,
+	// 转换消息
+	for _, msg := range req.Messages {
+		message, err := newOpenAIMessage(msg)
+		if err != nil {
+			return requestBody, err
+		}
+		requestBody.Messages = append(requestBody.Messages, message)
 	}
 
-	// 发送请求
-	resp, err := p.sendRequest(ctx, "POST", "/chat/completions", requestBody, headers)
-	if err != nil {
-		return "", err
+	// 转换工具定义
+	for _, tool := range req.Tools {
+		requestBody.Tools = append(requestBody.Tools, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
 	}
-	defer resp.Body.Close()
 
-	// 解析响应
-	var response OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+	// 转换工具选择策略
+	if req.ToolChoice != nil {
+		if req.ToolChoice.Mode == ToolChoiceTool {
+			requestBody.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]string{"name": req.ToolChoice.Name},
+			}
+		} else {
+			requestBody.ToolChoice = req.ToolChoice.Mode
+		}
 	}
+	return requestBody, nil
+}
 
-	// 检查错误
-	if response.Error != nil {
-		return "", fmt.Errorf("API错误: %s", response.Error.Message)
+// newOpenAIMessage 将统一的Message映射为OpenAI消息
+func newOpenAIMessage(msg Message) (OpenAIMessage, error) {
+	message := OpenAIMessage{
+		Role:       msg.Role,
+		Content:    msg.Content,
+		ToolCalls:  make([]OpenAIToolCall, 0, len(msg.ToolCalls)),
+		ToolCallID: msg.ToolCallID,
 	}
+	// 仅包含工具调用的助手消息使用null作为内容
+	if msg.Content == "" && len(msg.ToolCalls) > 0 {
+		message.Content = nil
+	}
+	// 多模态消息使用内容片段数组
+	if msg.hasParts() {
+		parts := make([]OpenAIContentPart, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			openAIPart, err := newOpenAIContentPart(part)
+			if err != nil {
+				return message, err
+			}
+			parts = append(parts, openAIPart)
+		}
+		message.Content = parts
+	}
+	for _, call := range msg.ToolCalls {
+		toolCall := OpenAIToolCall{ID: call.ID, Type: "function"}
+		toolCall.Function.Name = call.Name
+		toolCall.Function.Arguments = call.Arguments
+		message.ToolCalls = append(message.ToolCalls, toolCall)
+	}
+	return message, nil
+}
 
-	// 检查响应
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("响应中没有选择")
+// newOpenAIContentPart 将统一的ContentPart映射为OpenAI内容片段
+func newOpenAIContentPart(part ContentPart) (OpenAIContentPart, error) {
+	switch part.Type {
+	case ContentPartImage:
+		url := part.URL
+		if len(part.Data) > 0 {
+			url = part.dataURL()
+		}
+		return OpenAIContentPart{Type: "image_url", ImageURL: &OpenAIImageURL{URL: url}}, nil
+	case ContentPartDocument:
+		// Chat Completions接口的文件片段只接受内联数据
+		if len(part.Data) == 0 {
+			return OpenAIContentPart{}, fmt.Errorf("OpenAI接口不支持通过URL引用文档")
+		}
+		return OpenAIContentPart{Type: "file", File: &OpenAIFile{Filename: "document.pdf", FileData: part.dataURL()}}, nil
+	default:
+		return OpenAIContentPart{Type: "text", Text: part.Text}, nil
 	}
+}
 
-	return response.Choices[0].Message.Content, nil
+// toMessage 将OpenAI响应消息转换为统一的Message
+func (m OpenAIResponseMessage) toMessage() Message {
+	message := Message{
+		Role:    m.Role,
+		Content: m.Content,
+	}
+	for _, call := range m.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return message
 }
 
-// ChatWithContext 实现AIProvider接口的ChatWithContext方法
-func (p *OpenAIProvider) ChatWithContext(ctx context.Context, model string, messages []Message) (string, error) {
-	// 构建请求体
-	requestBody := OpenAIRequest{
-		Model:    model,
-		Messages: messages,
+// Do 实现AIProvider接口的Do方法
+func (p *OpenAIProvider) Do(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	req, err := p.prepareRequest(req)
+	if err != nil {
+		return nil, err
 	}
 
-	// 设置请求头
-	headers := map[string]string{
-		"Authorization": "Bearer " + p.apiKey,
+	requestBody, err := newOpenAIRequest(req, false)
+	if err != nil {
+		return nil, err
 	}
 
-	// 发送请求
-	resp, err := p.sendRequest(ctx, "POST", "/chat/completions", requestBody, headers)
+	// 发送请求，估算的token数包含最大输出token数，用于TPM限流
+	ctx = withRequestInfo(ctx, req.Model, EstimatePromptTokens(req)+req.MaxTokens, req.Priority)
+	resp, err := p.sendRequest(ctx, "POST", "/chat/completions", requestBody, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// 解析响应
 	var response OpenAIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+		return nil, fmt.Errorf("解析响应失败: %w", err)
 	}
 
 	// 检查错误
 	if response.Error != nil {
-		return "", fmt.Errorf("API错误: %s", response.Error.Message)
+		return nil, withRequestID(newAPIError(p.providerType, resp.StatusCode, response.Error), resp.Header)
 	}
 
 	// 检查响应
 	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("响应中没有选择")
+		return nil, fmt.Errorf("响应中没有选择")
 	}
 
-	return response.Choices[0].Message.Content, nil
+	choice := response.Choices[0]
+	return &ChatResponse{
+		ID:           response.ID,
+		Model:        response.Model,
+		Message:      choice.Message.toMessage(),
+		Reasoning:    choice.Message.ReasoningContent,
+		FinishReason: normalizeFinishReason(choice.FinishReason),
+		Usage:        response.Usage.toUsage(),
+	}, nil
 }
 
-// ChatStream 实现AIProvider接口的ChatStream方法
-func (p *OpenAIProvider) ChatStream(ctx context.Context, model string, msg string, callback func(chunk string) error) error {
-	// 构建请求体
-	requestBody := OpenAIRequest{
-		Model: model,
-		Messages: []Message{
-			{Role: "user", Content: msg},
-		},
-		Stream: true,
-	}
-
-	// 设置请求头
-	headers := map[string]string{
-		"Authorization": "Bearer " + p.apiKey,
-	}
+// Chat 实现AIProvider接口的Chat方法
+func (p *OpenAIProvider) Chat(ctx context.Context, model string, msg string) (string, error) {
+	return p.ChatWithContext(ctx, model, []Message{{Role: RoleUser, Content: msg}})
+}
 
-	// 发送请求
-	resp, err := p.sendRequest(ctx, "POST", "/chat/completions", requestBody, headers)
+// ChatWithContext 实现AIProvider接口的ChatWithContext方法
+func (p *OpenAIProvider) ChatWithContext(ctx context.Context, model string, messages []Message) (string, error) {
+	resp, err := p.Do(ctx, &ChatRequest{Model: model, Messages: messages})
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer resp.Body.Close()
+	return resp.Text(), nil
+}
 
-	// 处理流式响应
-	return p.handleStreamResponse(resp.Body, callback)
+// ChatStream 实现AIProvider接口的ChatStream方法
+func (p *OpenAIProvider) ChatStream(ctx context.Context, model string, msg string, callback func(chunk string) error) error {
+	return p.ChatStreamWithContext(ctx, model, []Message{{Role: RoleUser, Content: msg}}, callback)
 }
 
 // ChatStreamWithContext 实现AIProvider接口的ChatStreamWithContext方法
 func (p *OpenAIProvider) ChatStreamWithContext(ctx context.Context, model string, messages []Message, callback func(chunk string) error) error {
-	// 构建请求体
-	requestBody := OpenAIRequest{
-		Model:    model,
-		Messages: messages,
-		Stream:   true,
+	return p.DoStream(ctx, &ChatRequest{Model: model, Messages: messages}, textCallback(callback))
+}
+
+// DoStream 实现AIProvider接口的DoStream方法
+func (p *OpenAIProvider) DoStream(ctx context.Context, req *ChatRequest, callback func(event StreamEvent) error) error {
+	req, err := p.prepareRequest(req)
+	if err != nil {
+		return err
 	}
 
-	// 设置请求头
-	headers := map[string]string{
-		"Authorization": "Bearer " + p.apiKey,
+	requestBody, err := newOpenAIRequest(req, true)
+	if err != nil {
+		return err
 	}
 
-	// 发送请求
-	resp, err := p.sendRequest(ctx, "POST", "/chat/completions", requestBody, headers)
+	// 发送请求，估算的token数包含最大输出token数，用于TPM限流
+	ctx = withRequestInfo(ctx, req.Model, EstimatePromptTokens(req)+req.MaxTokens, req.Priority)
+	resp, err := p.sendRequest(ctx, "POST", "/chat/completions", requestBody, nil)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	// 处理流式响应
-	return p.handleStreamResponse(resp.Body, callback)
+	return withRequestID(p.handleStreamResponse(resp.Body, callback), resp.Header)
 }
 
 // handleStreamResponse 处理流式响应
-func (p *OpenAIProvider) handleStreamResponse(body io.Reader, callback func(chunk string) error) error {
+// 流以data: [DONE]结束；既没有收到[DONE]也没有收到结束原因就结束的流视为中断，返回包装了io.ErrUnexpectedEOF的错误
+func (p *OpenAIProvider) handleStreamResponse(body io.Reader, callback func(event StreamEvent) error) error {
 	p.logger.Info("开始处理流式响应")
-	
+
+	// 记录最近一次收到的用量，在流结束时统一发送
+	var usage *OpenAIUsage
+	started := false
+	// 是否收到了[DONE]或结束原因
+	finished := false
+
+	// emit 调用回调函数并记录失败日志
+	emit := func(event StreamEvent) error {
+		if err := callback(event); err != nil {
+			if isStreamAborted(err) {
+				p.logger.Debug("流式响应被消费方终止: %v", err)
+			} else {
+				p.logger.Error("回调函数执行失败: %v", err)
+			}
+			return err
+		}
+		return nil
+	}
+
 	// 创建一个扫描器来逐行读取响应
 	scanner := bufio.NewScanner(body)
 	for scanner.Scan() {
@@ -204,6 +429,7 @@ func (p *OpenAIProvider) handleStreamResponse(body io.Reader, callback func(chun
 		// 检查是否是结束信号
 		if line == "data: [DONE]" {
 			p.logger.Info("收到流式响应结束信号")
+			finished = true
 			break
 		}
 		// 提取JSON数据
@@ -217,20 +443,71 @@ func (p *OpenAIProvider) handleStreamResponse(body io.Reader, callback func(chun
 			}
 			// 检查错误
 			if response.Error != nil {
-				errorMsg := fmt.Sprintf("API错误: %s", response.Error.Message)
-				p.logger.Error("%s", errorMsg)
-				return fmt.Errorf("%s", errorMsg)
+				err := newAPIError(p.providerType, 0, response.Error)
+				p.logger.Error("%v", err)
+				if cbErr := emit(StreamEvent{Type: StreamEventError, Err: err}); cbErr != nil {
+					return cbErr
+				}
+				return err
+			}
+			// 记录用量
+			if response.Usage != nil {
+				usage = response.Usage
+			}
+			if len(response.Choices) == 0 {
+				continue
+			}
+			choice := response.Choices[0]
+			delta := choice.Delta
+
+			// 发送开始事件
+			if !started {
+				started = true
+				role := delta.Role
+				if role == "" {
+					role = RoleAssistant
+				}
+				if err := emit(StreamEvent{Type: StreamEventStart, ID: response.ID, Model: response.Model, Role: role}); err != nil {
+					return err
+				}
 			}
-			// 处理响应
-			if len(response.Choices) > 0 {
-				chunk := response.Choices[0].Delta.Content
-				if chunk != "" {
-					p.logger.Debug("收到流式响应 chunk: %s", chunk)
-					// 调用回调函数
-					if err := callback(chunk); err != nil {
-						p.logger.Error("回调函数执行失败: %v", err)
-						return err
-					}
+			// 处理推理增量
+			if delta.ReasoningContent != "" {
+				if err := emit(StreamEvent{Type: StreamEventReasoning, Text: delta.ReasoningContent}); err != nil {
+					return err
+				}
+			}
+			// 处理文本增量
+			if delta.Content != "" {
+				p.logger.Debug("收到流式响应 chunk: %s", delta.Content)
+				if err := emit(StreamEvent{Type: StreamEventText, Text: delta.Content}); err != nil {
+					return err
+				}
+			}
+			// 处理工具调用增量
+			for i, call := range delta.ToolCalls {
+				index := i
+				if call.Index != nil {
+					index = *call.Index
+				}
+				event := StreamEvent{
+					Type: StreamEventToolCall,
+					ToolCall: &ToolCallDelta{
+						Index:     index,
+						ID:        call.ID,
+						Name:      call.Function.Name,
+						Arguments: call.Function.Arguments,
+					},
+				}
+				if err := emit(event); err != nil {
+					return err
+				}
+			}
+			// 处理结束原因
+			if choice.FinishReason != "" {
+				finished = true
+				if err := emit(StreamEvent{Type: StreamEventStop, FinishReason: normalizeFinishReason(choice.FinishReason)}); err != nil {
+					return err
 				}
 			}
 		}
@@ -238,9 +515,26 @@ func (p *OpenAIProvider) handleStreamResponse(body io.Reader, callback func(chun
 
 	// 检查扫描器错误
 	if err := scanner.Err(); err != nil {
-		p.logger.Error("读取流式响应失败: %v", err)
+		if isStreamAborted(err) {
+			p.logger.Debug("流式响应被消费方终止: %v", err)
+		} else {
+			p.logger.Error("读取流式响应失败: %v", err)
+		}
 		return fmt.Errorf("读取流式响应失败: %w", err)
 	}
+	if !finished {
+		err := fmt.Errorf("流式响应在[DONE]之前中断: %w", io.ErrUnexpectedEOF)
+		p.logger.Error("%v", err)
+		return err
+	}
+
+	// 发送用量事件
+	if usage != nil {
+		u := usage.toUsage()
+		if err := emit(StreamEvent{Type: StreamEventUsage, Usage: &u}); err != nil {
+			return err
+		}
+	}
 
 	p.logger.Info("流式响应处理完成")
 	return nil
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+)
+
+// newOpenAIFixtureProvider 创建一个以testdata中录制的SSE事件作为响应的OpenAIProvider
+func newOpenAIFixtureProvider(t *testing.T, fixture string) AIProvider {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("读取测试数据失败: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("请求路径为%s，期望/chat/completions", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	prov, err := NewOpenAIProvider(&domain.Platform{
+		ID:      "openai",
+		Type:    "openai",
+		BaseURL: srv.URL,
+		APIKey:  "sk-test-key",
+	}, WithLogLevel(utils.FatalLevel))
+	if err != nil {
+		t.Fatalf("创建Provider失败: %v", err)
+	}
+	return prov
+}
+
+// collectOpenAIStream 发送流式请求并收集所有事件
+func collectOpenAIStream(t *testing.T, fixture string) ([]StreamEvent, error) {
+	t.Helper()
+	prov := newOpenAIFixtureProvider(t, fixture)
+	var events []StreamEvent
+	err := prov.DoStream(context.Background(), &ChatRequest{
+		Model:    "gpt-4o",
+		Messages: []Message{{Role: RoleUser, Content: "北京天气怎么样？"}},
+	}, func(event StreamEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// eventTypes 返回事件的类型序列
+func eventTypes(events []StreamEvent) []StreamEventType {
+	types := make([]StreamEventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestOpenAIStreamEvents(t *testing.T) {
+	events, err := collectOpenAIStream(t, "openai_stream.sse")
+	if err != nil {
+		t.Fatalf("DoStream返回错误: %v", err)
+	}
+
+	want := []StreamEvent{
+		{Type: StreamEventStart, ID: "chatcmpl-9f2a1c7e4b", Model: "deepseek-reasoner", Role: RoleAssistant},
+		{Type: StreamEventReasoning, Text: "用户想知道北京和上海的天气，"},
+		{Type: StreamEventReasoning, Text: "需要分别调用get_weather。"},
+		{Type: StreamEventText, Text: "我来查询两地的天气。"},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 0, ID: "call_0_8d3f6a2b", Name: "get_weather"}},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 0, Arguments: `{"city":`}},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 0, Arguments: `"北京"}`}},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 1, ID: "call_1_4c9e0f71", Name: "get_weather"}},
+		{Type: StreamEventToolCall, ToolCall: &ToolCallDelta{Index: 1, Arguments: `{"city":"上海"}`}},
+		{Type: StreamEventStop, FinishReason: FinishReasonToolCalls},
+		// 最后一个只包含用量、choices为空的数据块在流结束时作为用量事件发送
+		{Type: StreamEventUsage, Usage: &Usage{InputTokens: 152, OutputTokens: 96, CachedTokens: 64, ReasoningTokens: 41}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("事件不一致\n得到: %+v\n期望: %+v", events, want)
+	}
+
+	// 工具调用的参数片段按Index拼接
+	arguments := make(map[int]string)
+	for _, event := range events {
+		if event.Type == StreamEventToolCall {
+			arguments[event.ToolCall.Index] += event.ToolCall.Arguments
+		}
+	}
+	if want := map[int]string{0: `{"city":"北京"}`, 1: `{"city":"上海"}`}; !reflect.DeepEqual(arguments, want) {
+		t.Errorf("拼接后的工具调用参数为%v，期望%v", arguments, want)
+	}
+}
+
+func TestOpenAIStreamTruncated(t *testing.T) {
+	events, err := collectOpenAIStream(t, "openai_stream_truncated.sse")
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("DoStream返回%v，期望io.ErrUnexpectedEOF", err)
+	}
+	if got, want := eventTypes(events), []StreamEventType{StreamEventStart, StreamEventText}; !reflect.DeepEqual(got, want) {
+		t.Errorf("事件类型为%v，期望%v", got, want)
+	}
+}
+
+// TestOpenAIStreamWithoutDone 部分兼容平台发送结束原因后直接关闭连接，不视为中断
+func TestOpenAIStreamWithoutDone(t *testing.T) {
+	events, err := collectOpenAIStream(t, "openai_stream_no_done.sse")
+	if err != nil {
+		t.Fatalf("DoStream返回错误: %v", err)
+	}
+	want := []StreamEventType{StreamEventStart, StreamEventText, StreamEventStop}
+	if got := eventTypes(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("事件类型为%v，期望%v", got, want)
+	}
+}
@@ -3,14 +3,23 @@ package provider
 import (
 	"time"
 
+	"github.com/cn-maul/Baize/domain"
 	"github.com/cn-maul/Baize/pkg/utils"
 )
 
 // ProviderOptions 定义了Provider的配置选项
 type ProviderOptions struct {
-	Timeout    time.Duration
-	MaxRetries int
-	LogLevel   utils.LogLevel
+	Timeout      time.Duration
+	MaxRetries   int
+	RetryPolicy  RetryPolicy // 为nil时根据MaxRetries使用指数退避策略
+	KeySelection string      // API Key选择策略，为空时使用平台配置，见KeySelection*常量
+	// 熔断器配置，为nil时使用平台配置
+	CircuitBreaker *domain.CircuitBreakerConfig
+	// 客户端限流配置，为nil时使用平台配置
+	RateLimit *domain.RateLimitConfig
+	// 并发限制配置，为nil时使用平台配置
+	Concurrency *domain.ConcurrencyConfig
+	LogLevel    utils.LogLevel
 }
 
 // ProviderOption 定义了Option模式的函数类型
@@ -30,6 +39,41 @@ func WithMaxRetries(maxRetries int) ProviderOption {
 	}
 }
 
+// WithRetryPolicy 设置自定义的重试策略，优先于WithMaxRetries
+func WithRetryPolicy(policy RetryPolicy) ProviderOption {
+	return func(opts *ProviderOptions) {
+		opts.RetryPolicy = policy
+	}
+}
+
+// WithKeySelection 设置API Key选择策略，优先于平台配置中的key_selection
+func WithKeySelection(selection string) ProviderOption {
+	return func(opts *ProviderOptions) {
+		opts.KeySelection = selection
+	}
+}
+
+// WithCircuitBreaker 为Provider启用熔断器，优先于平台配置中的circuit_breaker
+func WithCircuitBreaker(config domain.CircuitBreakerConfig) ProviderOption {
+	return func(opts *ProviderOptions) {
+		opts.CircuitBreaker = &config
+	}
+}
+
+// WithRateLimit 为Provider启用客户端限流，优先于平台配置中的rate_limit
+func WithRateLimit(config domain.RateLimitConfig) ProviderOption {
+	return func(opts *ProviderOptions) {
+		opts.RateLimit = &config
+	}
+}
+
+// WithConcurrency 为Provider启用带优先级队列的并发限制，优先于平台配置中的concurrency
+func WithConcurrency(config domain.ConcurrencyConfig) ProviderOption {
+	return func(opts *ProviderOptions) {
+		opts.Concurrency = &config
+	}
+}
+
 // WithLogLevel 设置日志级别
 func WithLogLevel(logLevel utils.LogLevel) ProviderOption {
 	return func(opts *ProviderOptions) {
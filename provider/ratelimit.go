@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+// ErrLocalRateLimit 在上下文结束前无法获得客户端限流配额，请求未发送到上游
+var ErrLocalRateLimit = errors.New("客户端限流配额不足")
+
+// tokenBucket 令牌桶，容量为每分钟的配额，按秒匀速补充
+// 令牌数可以为负，表示已被预约的配额，后来的请求需要等待更久
+type tokenBucket struct {
+	capacity float64
+	rate     float64 // 每秒补充的令牌数
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket 创建每分钟perMinute个令牌的令牌桶，初始为满
+func newTokenBucket(perMinute int) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		tokens:   float64(perMinute),
+		last:     time.Now(),
+	}
+}
+
+// reserve 预约n个令牌并返回需要等待的时间，n超过容量时按容量计算以免永远无法满足
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= math.Min(n, b.capacity)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel 归还预约的令牌
+func (b *tokenBucket) cancel(n float64) {
+	b.tokens = math.Min(b.capacity, b.tokens+math.Min(n, b.capacity))
+}
+
+// limiterBuckets 单个限流键的请求数和token数令牌桶
+type limiterBuckets struct {
+	requests *tokenBucket // 为nil表示不限制请求数
+	tokens   *tokenBucket // 为nil表示不限制token数
+}
+
+// RateLimiter 基于令牌桶的客户端限流器，按RPM和估算的TPM限制发往上游的请求
+type RateLimiter struct {
+	mu      sync.Mutex
+	config  domain.RateLimitConfig
+	buckets map[string]*limiterBuckets
+}
+
+// NewRateLimiter 创建限流器
+func NewRateLimiter(config domain.RateLimitConfig) *RateLimiter {
+	if config.Scope == "" {
+		config.Scope = domain.RateLimitScopePlatform
+	}
+	return &RateLimiter{
+		config:  config,
+		buckets: make(map[string]*limiterBuckets),
+	}
+}
+
+// Scope 返回限流的作用范围
+func (l *RateLimiter) Scope() string {
+	return l.config.Scope
+}
+
+// Wait 阻塞直到key对应的配额允许发送一个消耗tokens个token的请求
+// 上下文在获得配额前结束，或截止时间早于获得配额的时间时，返回包装了ErrLocalRateLimit的错误
+func (l *RateLimiter) Wait(ctx context.Context, key string, tokens int) error {
+	l.mu.Lock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &limiterBuckets{}
+		if l.config.RPM > 0 {
+			b.requests = newTokenBucket(l.config.RPM)
+		}
+		if l.config.TPM > 0 {
+			b.tokens = newTokenBucket(l.config.TPM)
+		}
+		l.buckets[key] = b
+	}
+
+	now := time.Now()
+	var delay time.Duration
+	if b.requests != nil {
+		delay = max(delay, b.requests.reserve(now, 1))
+	}
+	if b.tokens != nil && tokens > 0 {
+		delay = max(delay, b.tokens.reserve(now, float64(tokens)))
+	}
+	release := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if b.requests != nil {
+			b.requests.cancel(1)
+		}
+		if b.tokens != nil && tokens > 0 {
+			b.tokens.cancel(float64(tokens))
+		}
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		release()
+		return fmt.Errorf("%w: 需要等待%v，超过上下文截止时间", ErrLocalRateLimit, delay.Round(time.Millisecond))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		release()
+		return fmt.Errorf("%w: %w", ErrLocalRateLimit, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// waitRateLimit 等待限流配额，未启用限流时直接返回
+func (p *BaseProvider) waitRateLimit(ctx context.Context, apiKey string) error {
+	if p.limiter == nil {
+		return nil
+	}
+	info := requestInfoFrom(ctx)
+	key := ""
+	switch p.limiter.Scope() {
+	case domain.RateLimitScopeModel:
+		key = info.model
+	case domain.RateLimitScopeKey:
+		key = apiKey
+	}
+	return p.limiter.Wait(ctx, key, info.tokens)
+}
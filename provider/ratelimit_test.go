@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := newTokenBucket(60) // 每秒补充1个令牌
+	now := b.last
+
+	if delay := b.reserve(now, 60); delay != 0 {
+		t.Fatalf("桶满时预约全部令牌需等待%v，期望0", delay)
+	}
+	if delay := b.reserve(now, 2); delay != 2*time.Second {
+		t.Fatalf("令牌耗尽后预约2个需等待%v，期望2s", delay)
+	}
+	// 后来的请求排在已预约的配额之后
+	if delay := b.reserve(now, 1); delay != 3*time.Second {
+		t.Fatalf("第二次预约需等待%v，期望3s", delay)
+	}
+	// 经过1秒补充1个令牌
+	if delay := b.reserve(now.Add(time.Second), 0); delay != 2*time.Second {
+		t.Fatalf("1秒后剩余等待%v，期望2s", delay)
+	}
+	// 超过容量的预约按容量计算
+	b = newTokenBucket(60)
+	if delay := b.reserve(b.last, 600); delay != 0 {
+		t.Fatalf("超过容量的预约需等待%v，期望按容量计算为0", delay)
+	}
+}
+
+func TestTokenBucketCancel(t *testing.T) {
+	b := newTokenBucket(60)
+	now := b.last
+
+	b.reserve(now, 60)
+	b.reserve(now, 3)
+	b.cancel(3)
+	if delay := b.reserve(now, 1); delay != time.Second {
+		t.Fatalf("归还预约后需等待%v，期望1s", delay)
+	}
+	// 归还不会超过容量
+	b = newTokenBucket(60)
+	b.cancel(30)
+	if b.tokens != 60 {
+		t.Fatalf("归还后令牌数为%v，期望不超过容量60", b.tokens)
+	}
+}
+
+func TestRateLimiterWaitDeadlineExceeded(t *testing.T) {
+	l := NewRateLimiter(domain.RateLimitConfig{RPM: 60})
+	if err := l.Wait(context.Background(), "", 0); err != nil {
+		t.Fatalf("配额充足时Wait返回%v", err)
+	}
+	// 桶容量为60，耗尽后下一个请求需等待约1秒
+	for range 59 {
+		if err := l.Wait(context.Background(), "", 0); err != nil {
+			t.Fatalf("配额充足时Wait返回%v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := l.Wait(ctx, "", 0)
+	if !errors.Is(err, ErrLocalRateLimit) {
+		t.Fatalf("截止时间早于获得配额的时间时Wait返回%v，期望ErrLocalRateLimit", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Wait等待了%v才返回，期望立即返回", elapsed)
+	}
+	// 放弃的请求归还预约，不会推迟后来的请求
+	if delay := l.buckets[""].requests.reserve(time.Now(), 0); delay > time.Second {
+		t.Errorf("放弃后剩余等待%v，期望不超过1s", delay)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := NewRateLimiter(domain.RateLimitConfig{TPM: 600})
+	if err := l.Wait(context.Background(), "", 600); err != nil {
+		t.Fatalf("配额充足时Wait返回%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err := l.Wait(ctx, "", 100)
+	if !errors.Is(err, ErrLocalRateLimit) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("等待期间取消时Wait返回%v，期望同时包装ErrLocalRateLimit和Canceled", err)
+	}
+}
+
+// TestRateLimitEmbedAndRerank 向量化和重排序请求按模型计入限流，并消耗估算的token数
+func TestRateLimitEmbedAndRerank(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/embeddings":
+			w.Write([]byte(`{"data":[{"index":0,"embedding":[0.1]},{"index":1,"embedding":[0.2]}]}`))
+		case "/rerank":
+			w.Write([]byte(`{"results":[{"index":0,"relevance_score":0.9}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	platform := &domain.Platform{ID: "p", Type: "openai", BaseURL: srv.URL, APIKey: "sk-test-key", Capabilities: []string{domain.CapabilityRerank}}
+	prov, err := NewOpenAIProvider(platform,
+		WithRateLimit(domain.RateLimitConfig{TPM: 60, Scope: domain.RateLimitScopeModel}), WithLogLevel(utils.FatalLevel))
+	if err != nil {
+		t.Fatalf("创建Provider失败: %v", err)
+	}
+	p := prov.(*OpenAIProvider)
+
+	if _, err := p.Embed(context.Background(), &EmbeddingRequest{Model: "embed", Input: []string{"abcdefgh", "你好"}}); err != nil {
+		t.Fatalf("Embed失败: %v", err)
+	}
+	if _, err := p.Rerank(context.Background(), &RerankRequest{Model: "rerank", Query: "abcd", Documents: []string{"abcdefgh"}}); err != nil {
+		t.Fatalf("Rerank失败: %v", err)
+	}
+
+	// 按输入估算：embed为2+2个token，rerank为1+2个token
+	for model, want := range map[string]float64{"embed": 4, "rerank": 3} {
+		b, ok := p.limiter.buckets[model]
+		if !ok {
+			t.Fatalf("模型%s没有计入限流", model)
+		}
+		if used := b.tokens.capacity - b.tokens.tokens; used < want-0.5 || used > want {
+			t.Errorf("模型%s消耗了%.2f个token，期望%v", model, used, want)
+		}
+	}
+}
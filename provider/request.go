@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+// ChatRequest 统一的聊天请求结构，由各Provider映射到各自的接口格式
+type ChatRequest struct {
+	Model    string    // 模型名称
+	Messages []Message // 消息历史
+
+	// 生成参数，nil或零值表示使用平台默认值
+	Temperature      *float64 // 采样温度
+	TopP             *float64 // 核采样概率
+	MaxTokens        int      // 最大生成token数
+	Stop             []string // 停止序列
+	Seed             *int64   // 随机种子（Anthropic不支持，将被忽略）
+	PresencePenalty  *float64 // 存在惩罚（Anthropic不支持，将被忽略）
+	FrequencyPenalty *float64 // 频率惩罚（Anthropic不支持，将被忽略）
+
+	// 工具调用
+	Tools      []Tool      // 可供模型调用的工具
+	ToolChoice *ToolChoice // 工具选择策略，nil表示使用平台默认值
+
+	// 请求优先级，平台启用并发限制时数值越大越先获得执行机会，见Priority*常量
+	Priority int
+
+	// 请求标签和元数据，供Router的路由规则匹配使用，不会发送给上游
+	Tags     []string
+	Metadata map[string]string
+}
+
+// 常用的请求优先级
+const (
+	// PriorityBatch 批处理任务
+	PriorityBatch = -10
+	// PriorityNormal 默认优先级
+	PriorityNormal = 0
+	// PriorityInteractive 交互式请求
+	PriorityInteractive = 10
+)
+
+// ChatResponse 统一的聊天响应结构
+type ChatResponse struct {
+	ID           string  // 响应ID
+	Model        string  // 实际响应的模型
+	Message      Message // 助手回复的消息
+	Reasoning    string  // 推理（思考）过程内容，平台支持时有效
+	FinishReason string  // 归一化的结束原因，见FinishReason*常量
+	Usage        Usage   // token用量
+
+	// 经Router转发时记录的尝试，最后一项为成功的目标
+	Attempts []Attempt
+}
+
+// Attempt Router对单个目标的一次尝试
+type Attempt struct {
+	Platform string        // 平台ID
+	Model    string        // 实际请求的模型
+	Latency  time.Duration // 耗时
+	Err      error         // 失败原因，成功时为nil
+}
+
+// Usage 归一化的token用量
+type Usage struct {
+	InputTokens     int // 输入token数（包含缓存命中部分）
+	OutputTokens    int // 输出token数（包含推理部分）
+	CachedTokens    int // 输入中命中缓存的token数
+	ReasoningTokens int // 输出中用于推理的token数
+}
+
+// TotalTokens 返回输入与输出token数之和
+func (u Usage) TotalTokens() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// Text 返回回复的文本内容
+func (r *ChatResponse) Text() string {
+	return r.Message.Content
+}
+
+// Ptr 返回值的指针，便于设置ChatRequest中的可选参数
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// validate 检查请求的必填字段
+func (r *ChatRequest) validate() error {
+	if r == nil {
+		return fmt.Errorf("请求不能为空")
+	}
+	if r.Model == "" {
+		return fmt.Errorf("请求缺少模型名称")
+	}
+	if len(r.Messages) == 0 {
+		return fmt.Errorf("请求中没有消息")
+	}
+	for _, msg := range r.Messages {
+		for _, part := range msg.Parts {
+			if err := part.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if r.ToolChoice != nil && r.ToolChoice.Mode == ToolChoiceTool && r.ToolChoice.Name == "" {
+		return fmt.Errorf("工具选择模式为tool时必须指定工具名称")
+	}
+	return nil
+}
+
+// prepareRequest 校验请求，并根据平台配置中的模型元数据补全默认参数、检查模型能力
+// 返回的请求是副本，不会修改调用方传入的请求
+func (p *BaseProvider) prepareRequest(req *ChatRequest) (*ChatRequest, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	model := p.findModel(req.Model)
+	if model == nil {
+		return req, nil
+	}
+	if err := checkModelCapabilities(model, req); err != nil {
+		return nil, err
+	}
+
+	prepared := *req
+	if prepared.Temperature == nil {
+		prepared.Temperature = model.Defaults.Temperature
+	}
+	if prepared.TopP == nil {
+		prepared.TopP = model.Defaults.TopP
+	}
+	if prepared.MaxTokens <= 0 {
+		prepared.MaxTokens = model.Defaults.MaxTokens
+	}
+	if model.MaxOutputTokens > 0 && prepared.MaxTokens > model.MaxOutputTokens {
+		p.logger.Debug("MaxTokens超过模型 %s 的最大输出token数，已调整为%d", model.Name, model.MaxOutputTokens)
+		prepared.MaxTokens = model.MaxOutputTokens
+	}
+	return &prepared, nil
+}
+
+// findModel 查找平台配置中的模型元数据，未配置时返回nil
+func (p *BaseProvider) findModel(name string) *domain.Model {
+	if p.platform == nil {
+		return nil
+	}
+	return p.platform.FindModel(name)
+}
+
+// checkModelCapabilities 根据模型声明的能力检查请求，能力未知时不做检查
+func checkModelCapabilities(model *domain.Model, req *ChatRequest) error {
+	caps := model.Capabilities
+	if caps == nil {
+		return nil
+	}
+	if caps.Embeddings {
+		return fmt.Errorf("模型 %s 是向量化模型，不支持对话: %w", model.Name, ErrUnsupported)
+	}
+	if !caps.Tools && len(req.Tools) > 0 {
+		return fmt.Errorf("模型 %s 不支持工具调用: %w", model.Name, ErrUnsupported)
+	}
+	if !caps.Vision {
+		for _, msg := range req.Messages {
+			for _, part := range msg.Parts {
+				if part.Type == ContentPartImage {
+					return fmt.Errorf("模型 %s 不支持图片输入: %w", model.Name, ErrUnsupported)
+				}
+			}
+		}
+	}
+	return nil
+}
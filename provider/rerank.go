@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+// RerankRequest 重排序请求
+type RerankRequest struct {
+	Model           string   // 模型名称
+	Query           string   // 查询文本
+	Documents       []string // 待排序的文档
+	TopN            int      // 返回的结果数量，0表示返回全部
+	ReturnDocuments bool     // 是否在结果中返回文档原文
+}
+
+// RerankResult 单个文档的重排序结果
+type RerankResult struct {
+	Index    int     // 文档在请求Documents中的序号
+	Score    float64 // 相关性分数，越大越相关
+	Document string  // 文档原文，仅在ReturnDocuments为true时有效
+}
+
+// RerankResponse 重排序响应
+type RerankResponse struct {
+	ID      string         // 响应ID
+	Results []RerankResult // 按相关性分数降序排列的结果
+	Usage   Usage          // token用量，平台返回时有效
+}
+
+// validate 检查请求的必填字段
+func (r *RerankRequest) validate() error {
+	if r == nil {
+		return fmt.Errorf("请求不能为空")
+	}
+	if r.Model == "" {
+		return fmt.Errorf("请求缺少模型名称")
+	}
+	if r.Query == "" {
+		return fmt.Errorf("请求缺少查询文本")
+	}
+	if len(r.Documents) == 0 {
+		return fmt.Errorf("请求中没有文档")
+	}
+	return nil
+}
+
+// CohereRerankRequest 与Cohere兼容的重排序请求结构，SiliconFlow、Jina等平台使用相同格式
+type CohereRerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments bool     `json:"return_documents"`
+}
+
+// CohereRerankResponse 与Cohere兼容的重排序响应结构
+type CohereRerankResponse struct {
+	ID      string `json:"id"`
+	Results []struct {
+		Index          int             `json:"index"`
+		RelevanceScore float64         `json:"relevance_score"`
+		Document       json.RawMessage `json:"document,omitempty"` // {"text": "..."}或字符串
+	} `json:"results"`
+	Meta *struct {
+		Tokens *struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"tokens,omitempty"`
+	} `json:"meta,omitempty"`
+	Usage *struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// usage 将响应中的用量转换为归一化的Usage
+func (r *CohereRerankResponse) usage() Usage {
+	if r.Meta != nil && r.Meta.Tokens != nil {
+		return Usage{InputTokens: r.Meta.Tokens.InputTokens, OutputTokens: r.Meta.Tokens.OutputTokens}
+	}
+	if r.Usage != nil {
+		return Usage{InputTokens: r.Usage.TotalTokens}
+	}
+	return Usage{}
+}
+
+// Rerank 实现Reranker接口的Rerank方法，仅在平台声明了rerank能力时可用
+func (p *OpenAIProvider) Rerank(ctx context.Context, req *RerankRequest) (*RerankResponse, error) {
+	if !p.platform.HasCapability(domain.CapabilityRerank) {
+		return nil, fmt.Errorf("平台 %s 未声明rerank能力: %w", p.platform.ID, ErrUnsupported)
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	requestBody := CohereRerankRequest{
+		Model:           req.Model,
+		Query:           req.Query,
+		Documents:       req.Documents,
+		TopN:            req.TopN,
+		ReturnDocuments: req.ReturnDocuments,
+	}
+
+	// 按查询和文档估算token数，供限流使用
+	tokens := EstimateTextTokens(req.Query)
+	for _, document := range req.Documents {
+		tokens += EstimateTextTokens(document)
+	}
+	ctx = withRequestInfo(ctx, req.Model, tokens, PriorityNormal)
+
+	// 发送请求
+	resp, err := p.sendRequest(ctx, "POST", "/rerank", requestBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	var response CohereRerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	// 检查错误
+	if response.Error != nil {
+		return nil, withRequestID(newAPIError(p.providerType, resp.StatusCode, response.Error), resp.Header)
+	}
+
+	results := make([]RerankResult, 0, len(response.Results))
+	for _, item := range response.Results {
+		if item.Index < 0 || item.Index >= len(req.Documents) {
+			return nil, fmt.Errorf("响应中的文档序号%d超出范围", item.Index)
+		}
+		result := RerankResult{Index: item.Index, Score: item.RelevanceScore}
+		if req.ReturnDocuments {
+			result.Document = decodeRerankDocument(item.Document)
+			// 部分平台不返回文档原文，使用请求中的文档补全
+			if result.Document == "" {
+				result.Document = req.Documents[item.Index]
+			}
+		}
+		results = append(results, result)
+	}
+
+	// 按相关性分数降序排列
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return &RerankResponse{
+		ID:      response.ID,
+		Results: results,
+		Usage:   response.usage(),
+	}, nil
+}
+
+// decodeRerankDocument 解析{"text": "..."}或字符串格式的文档
+func decodeRerankDocument(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var doc struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &doc); err == nil {
+		return doc.Text
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return ""
+}
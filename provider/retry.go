@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy 重试策略，可通过WithRetryPolicy替换默认实现
+type RetryPolicy interface {
+	// Backoff 判断第attempt次重试（从1开始）是否应该进行，并返回重试前的等待时间
+	// err为上一次请求的错误
+	Backoff(attempt int, err error) (time.Duration, bool)
+}
+
+// ExponentialBackoff 带抖动的指数退避重试策略
+// 仅重试连接错误以及408/409/429/5xx、过载等可重试的APIError，并优先使用平台返回的Retry-After
+type ExponentialBackoff struct {
+	MaxRetries int           // 最大重试次数
+	BaseDelay  time.Duration // 第一次重试的基础等待时间
+	MaxDelay   time.Duration // 单次等待时间上限，Retry-After超过该值时不再重试
+}
+
+// NewExponentialBackoff 使用默认的等待时间创建指数退避重试策略
+func NewExponentialBackoff(maxRetries int) *ExponentialBackoff {
+	return &ExponentialBackoff{
+		MaxRetries: maxRetries,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   30 * time.Second,
+	}
+}
+
+// Backoff 实现RetryPolicy接口
+func (b *ExponentialBackoff) Backoff(attempt int, err error) (time.Duration, bool) {
+	if attempt > b.MaxRetries || !IsRetryable(err) {
+		return 0, false
+	}
+
+	// 优先使用平台返回的Retry-After
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if b.MaxDelay > 0 && apiErr.RetryAfter > b.MaxDelay {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	// 指数退避：BaseDelay * 2^(attempt-1)，不超过MaxDelay
+	delay := b.BaseDelay << (attempt - 1)
+	if delay <= 0 || (b.MaxDelay > 0 && delay > b.MaxDelay) {
+		delay = b.MaxDelay
+	}
+	// 抖动：在[delay/2, delay]之间随机取值，避免多个客户端同时重试
+	if half := delay / 2; half > 0 {
+		delay = half + rand.N(half+1)
+	}
+	return delay, true
+}
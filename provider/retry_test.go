@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+)
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	b := &ExponentialBackoff{MaxRetries: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	errServer := &APIError{StatusCode: 500, Err: ErrServer}
+
+	for attempt, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second, // 不超过MaxDelay
+	} {
+		for range 100 {
+			delay, retry := b.Backoff(attempt, errServer)
+			if !retry {
+				t.Fatalf("第%d次重试被拒绝", attempt)
+			}
+			if delay < want/2 || delay > want {
+				t.Fatalf("第%d次重试等待%v，期望在[%v, %v]之间", attempt, delay, want/2, want)
+			}
+		}
+	}
+
+	if _, retry := b.Backoff(6, errServer); retry {
+		t.Error("超过MaxRetries后仍然重试")
+	}
+	if _, retry := b.Backoff(1, &APIError{StatusCode: 400, Err: ErrBadRequest}); retry {
+		t.Error("不可重试的错误被重试")
+	}
+	if _, retry := b.Backoff(1, fmt.Errorf("发送请求失败: %w", ErrConnection)); !retry {
+		t.Error("连接错误没有重试")
+	}
+}
+
+func TestExponentialBackoffRetryAfter(t *testing.T) {
+	b := &ExponentialBackoff{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+	delay, retry := b.Backoff(1, &APIError{StatusCode: 429, RetryAfter: 3 * time.Second, Err: ErrRateLimited})
+	if !retry || delay != 3*time.Second {
+		t.Errorf("Retry-After为3s时等待%v（重试: %v），期望使用Retry-After", delay, retry)
+	}
+	if _, retry := b.Backoff(1, &APIError{StatusCode: 429, RetryAfter: time.Minute, Err: ErrRateLimited}); retry {
+		t.Error("Retry-After超过MaxDelay时仍然重试")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+	}{
+		{"seconds", map[string]string{"Retry-After": "2"}, 2 * time.Second},
+		{"fraction", map[string]string{"Retry-After": "0.5"}, 500 * time.Millisecond},
+		{"milliseconds_first", map[string]string{"Retry-After": "2", "retry-after-ms": "150"}, 150 * time.Millisecond},
+		{"invalid", map[string]string{"Retry-After": "soon"}, 0},
+		{"missing", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			if got := parseRetryAfter(header); got != tt.want {
+				t.Errorf("解析结果为%v，期望%v", got, tt.want)
+			}
+		})
+	}
+
+	// HTTP日期格式
+	header := http.Header{}
+	header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if got := parseRetryAfter(header); got < 58*time.Second || got > time.Minute {
+		t.Errorf("HTTP日期格式解析结果为%v，期望约1分钟", got)
+	}
+}
+
+// newRetryTestProvider 创建指向handler的OpenAI Provider
+func newRetryTestProvider(t *testing.T, handler http.HandlerFunc, options ...ProviderOption) *OpenAIProvider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	options = append([]ProviderOption{WithLogLevel(utils.FatalLevel)}, options...)
+	prov, err := NewOpenAIProvider(&domain.Platform{ID: "p", Type: "openai", BaseURL: srv.URL, APIKey: "sk-test-key"}, options...)
+	if err != nil {
+		t.Fatalf("创建Provider失败: %v", err)
+	}
+	return prov.(*OpenAIProvider)
+}
+
+func TestSendWithRetry(t *testing.T) {
+	var calls atomic.Int32
+	p := newRetryTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}, WithRetryPolicy(&ExponentialBackoff{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}))
+
+	if _, err := p.ListModels(context.Background()); err != nil {
+		t.Fatalf("重试后仍然失败: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("上游收到%d个请求，期望3个", got)
+	}
+}
+
+func TestSendWithRetryDeadline(t *testing.T) {
+	var calls atomic.Int32
+	p := newRetryTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithMaxRetries(3))
+
+	// Retry-After超过上下文截止时间时立即放弃，不等待到截止时间
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := p.ListModels(ctx)
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("ListModels返回%v，期望ErrOverloaded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("ListModels耗时%v，期望立即放弃重试", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("上游收到%d个请求，期望1个", got)
+	}
+}
@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// StreamEventType 流式事件类型
+type StreamEventType string
+
+const (
+	// StreamEventStart 流开始，携带响应ID、模型和角色
+	StreamEventStart StreamEventType = "start"
+	// StreamEventText 文本增量
+	StreamEventText StreamEventType = "text"
+	// StreamEventReasoning 推理（思考）过程增量
+	StreamEventReasoning StreamEventType = "reasoning"
+	// StreamEventToolCall 工具调用增量
+	StreamEventToolCall StreamEventType = "tool_call"
+	// StreamEventStop 生成结束，携带结束原因
+	StreamEventStop StreamEventType = "stop"
+	// StreamEventUsage token用量，在流结束时发送
+	StreamEventUsage StreamEventType = "usage"
+	// StreamEventError 流中出现错误，回调返回后DoStream也将返回该错误
+	StreamEventError StreamEventType = "error"
+)
+
+// 归一化的结束原因
+const (
+	// FinishReasonStop 自然结束或命中停止序列
+	FinishReasonStop = "stop"
+	// FinishReasonLength 达到最大token数
+	FinishReasonLength = "length"
+	// FinishReasonToolCalls 模型发起了工具调用
+	FinishReasonToolCalls = "tool_calls"
+	// FinishReasonContentFilter 内容被过滤或模型拒绝回答
+	FinishReasonContentFilter = "content_filter"
+)
+
+// StreamEvent 流式响应中的单个事件
+type StreamEvent struct {
+	Type         StreamEventType // 事件类型
+	ID           string          // 响应ID，Type为StreamEventStart时有效
+	Model        string          // 实际响应的模型，Type为StreamEventStart时有效
+	Role         string          // 消息角色，Type为StreamEventStart时有效
+	Text         string          // 文本或推理增量，Type为StreamEventText或StreamEventReasoning时有效
+	ToolCall     *ToolCallDelta  // 工具调用增量，Type为StreamEventToolCall时有效
+	FinishReason string          // 归一化的结束原因，Type为StreamEventStop时有效
+	Usage        *Usage          // token用量，Type为StreamEventUsage时有效
+	Err          error           // 错误，Type为StreamEventError时有效
+	Attempts     []Attempt       // 经Router转发时记录的尝试，Type为StreamEventStart时有效
+}
+
+// textCallback 将只关心文本的回调函数适配为事件回调
+func textCallback(callback func(chunk string) error) func(event StreamEvent) error {
+	return func(event StreamEvent) error {
+		if event.Type != StreamEventText {
+			return nil
+		}
+		return callback(event.Text)
+	}
+}
+
+// normalizeFinishReason 将各平台的结束原因归一化，未知原因原样返回
+func normalizeFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence", "pause_turn":
+		return FinishReasonStop
+	case "max_tokens":
+		return FinishReasonLength
+	case "tool_use", "function_call":
+		return FinishReasonToolCalls
+	case "refusal":
+		return FinishReasonContentFilter
+	default:
+		return reason
+	}
+}
+
+// errStopIteration 迭代器消费方提前停止时用于终止底层流的内部错误
+var errStopIteration = errors.New("迭代已停止")
+
+// errStreamClosed 在Stream关闭后继续调用Recv时返回
+var errStreamClosed = errors.New("流已关闭")
+
+// isStreamAborted 判断错误是否由消费方主动终止流引起（提前退出迭代、关闭Stream或取消上下文），这类错误不是故障
+func isStreamAborted(err error) bool {
+	return errors.Is(err, errStopIteration) || errors.Is(err, context.Canceled)
+}
+
+// StreamEvents 以range-over-func迭代器的形式流式获取回复
+// 消费方提前退出循环时会终止底层流并关闭响应体；请求或流中的错误只作为最后一个元素返回，不会再以StreamEventError事件返回
+func StreamEvents(ctx context.Context, p AIProvider, req *ChatRequest) iter.Seq2[StreamEvent, error] {
+	return func(yield func(StreamEvent, error) bool) {
+		err := p.DoStream(ctx, req, func(event StreamEvent) error {
+			if event.Type == StreamEventError {
+				return nil
+			}
+			if !yield(event, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			yield(StreamEvent{}, err)
+		}
+	}
+}
+
+// Stream 基于Recv/Close语义的流式响应
+// 底层流在独立的goroutine中读取，Close会终止读取并等待响应体关闭
+type Stream struct {
+	events    chan StreamEvent
+	done      chan struct{}
+	cancel    context.CancelFunc
+	err       error
+	closed    atomic.Bool
+	closeOnce sync.Once
+}
+
+// NewStream 发起流式请求并返回Stream，使用完毕后必须调用Close
+func NewStream(ctx context.Context, p AIProvider, req *ChatRequest) *Stream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream{
+		events: make(chan StreamEvent),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	go func() {
+		defer close(s.done)
+		err := p.DoStream(ctx, req, func(event StreamEvent) error {
+			// 错误由Recv在最后返回
+			if event.Type == StreamEventError {
+				return nil
+			}
+			select {
+			case s.events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		// 先记录错误再关闭通道，保证Recv读取到通道关闭时能看到错误
+		s.err = err
+		close(s.events)
+	}()
+
+	return s
+}
+
+// Recv 接收下一个事件，流正常结束时返回io.EOF，请求或流中出现错误时返回该错误
+func (s *Stream) Recv() (StreamEvent, error) {
+	if s.closed.Load() {
+		return StreamEvent{}, errStreamClosed
+	}
+	event, ok := <-s.events
+	if !ok {
+		if s.err != nil {
+			return StreamEvent{}, s.err
+		}
+		return StreamEvent{}, io.EOF
+	}
+	return event, nil
+}
+
+// Close 终止流并等待底层响应体关闭，可重复调用
+func (s *Stream) Close() error {
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+		s.cancel()
+		<-s.done
+	})
+	return nil
+}
@@ -0,0 +1,52 @@
+package provider
+
+import "unicode/utf8"
+
+// 估算token数时使用的经验值
+const (
+	// messageOverheadTokens 每条消息的格式开销
+	messageOverheadTokens = 4
+	// imageTokens 单张图片的估算token数
+	imageTokens = 1000
+	// documentTokens 单个文档的估算token数
+	documentTokens = 1500
+)
+
+// EstimateTextTokens 粗略估算文本的token数：ASCII字符约4个一个token，其他字符（如中文）约1个一个token
+func EstimateTextTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// EstimatePromptTokens 粗略估算请求输入部分的token数，包括消息、多模态内容和工具定义
+// 仅用于限流和路由等需要预估用量的场景，不能代替平台返回的实际用量
+func EstimatePromptTokens(req *ChatRequest) int {
+	tokens := 0
+	for _, msg := range req.Messages {
+		tokens += messageOverheadTokens + EstimateTextTokens(msg.Content)
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case ContentPartText:
+				tokens += EstimateTextTokens(part.Text)
+			case ContentPartImage:
+				tokens += imageTokens
+			case ContentPartDocument:
+				tokens += documentTokens
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			tokens += EstimateTextTokens(call.Name) + EstimateTextTokens(call.Arguments)
+		}
+	}
+	for _, tool := range req.Tools {
+		tokens += EstimateTextTokens(tool.Name) + EstimateTextTokens(tool.Description) + EstimateTextTokens(string(tool.Parameters))
+	}
+	return tokens
+}
@@ -0,0 +1,43 @@
+package provider
+
+import "encoding/json"
+
+// 工具选择模式
+const (
+	// ToolChoiceAuto 由模型自行决定是否调用工具
+	ToolChoiceAuto = "auto"
+	// ToolChoiceNone 禁止模型调用工具
+	ToolChoiceNone = "none"
+	// ToolChoiceRequired 要求模型至少调用一个工具
+	ToolChoiceRequired = "required"
+	// ToolChoiceTool 要求模型调用指定名称的工具
+	ToolChoiceTool = "tool"
+)
+
+// Tool 与平台无关的工具（函数）定义
+type Tool struct {
+	Name        string          `json:"name"`                  // 工具名称
+	Description string          `json:"description,omitempty"` // 工具描述
+	Parameters  json.RawMessage `json:"parameters,omitempty"`  // 参数的JSON Schema
+}
+
+// ToolChoice 工具选择策略
+type ToolChoice struct {
+	Mode string // auto, none, required, tool
+	Name string // Mode为tool时指定的工具名称
+}
+
+// ToolCall 助手消息中的一次工具调用
+type ToolCall struct {
+	ID        string `json:"id"`        // 工具调用ID，工具结果消息通过它关联
+	Name      string `json:"name"`      // 工具名称
+	Arguments string `json:"arguments"` // JSON编码的调用参数
+}
+
+// ToolCallDelta 流式响应中工具调用的增量
+type ToolCallDelta struct {
+	Index     int    // 工具调用在本次回复中的序号
+	ID        string // 工具调用ID，仅在该调用的第一个增量中出现
+	Name      string // 工具名称，仅在该调用的第一个增量中出现
+	Arguments string // 调用参数的JSON片段
+}
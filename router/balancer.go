@@ -0,0 +1,274 @@
+package router
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/provider"
+)
+
+// 内置的负载均衡策略
+const (
+	// BalanceWeighted 按权重随机排序
+	BalanceWeighted = "weighted"
+	// BalanceLeastInFlight 优先选择进行中请求最少的目标
+	BalanceLeastInFlight = "least_in_flight"
+	// BalanceLatency 优先选择EWMA延迟最低的目标
+	BalanceLatency = "latency"
+	// BalanceTTFT 优先选择EWMA首个事件时间最短的目标
+	BalanceTTFT = "ttft"
+	// BalanceCheapest 优先选择模型价格最低的目标，不同币种的价格不互相比较，未配置价格的目标排在最后
+	BalanceCheapest = "cheapest"
+)
+
+// ewmaAlpha EWMA的平滑系数，越大越偏向最近的观测值
+const ewmaAlpha = 0.3
+
+// failurePenalty 最近一次请求失败的目标在latency和ttft策略中排在最后的时长，过后重新参与排序以便发现恢复
+const failurePenalty = 30 * time.Second
+
+// Balancer 负载均衡策略，决定等价目标的尝试顺序
+type Balancer interface {
+	// Order 返回排序后的目标，排在前面的先尝试，不得修改传入的切片
+	Order(targets []*Target) []*Target
+}
+
+// BalancerFunc 函数形式的Balancer
+type BalancerFunc func(targets []*Target) []*Target
+
+// Order 实现Balancer接口
+func (f BalancerFunc) Order(targets []*Target) []*Target {
+	return f(targets)
+}
+
+// TargetStats 单个目标（平台、模型）的观测统计
+type TargetStats struct {
+	Platform string        // 平台ID
+	Model    string        // 模型名称
+	InFlight int64         // 进行中的请求数
+	Requests int64         // 累计请求数
+	Failures int64         // 累计失败数，不包括调用方取消、回调返回错误和对冲落后被取消的请求
+	Latency  time.Duration // 成功请求耗时的EWMA，流式请求为整个流的耗时
+	TTFT     time.Duration // 流式请求首个内容（文本、推理或工具调用）事件时间的EWMA
+
+	ConsecutiveFailures int64     // 连续失败数，成功后清零
+	LastFailure         time.Time // 最近一次失败的时间
+}
+
+// failing 判断目标最近是否连续失败，处于failurePenalty内的目标在latency和ttft策略中排在最后
+func (s TargetStats) failing() bool {
+	return s.ConsecutiveFailures > 0 && time.Since(s.LastFailure) < failurePenalty
+}
+
+// targetStats 单个目标的统计，由同一平台和模型的所有Target共享
+type targetStats struct {
+	mu     sync.Mutex
+	stats  TargetStats
+	health HealthStatus
+}
+
+// snapshot 返回统计快照
+func (s *targetStats) snapshot() TargetStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// begin 记录请求开始
+func (s *targetStats) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.InFlight++
+	s.stats.Requests++
+}
+
+// end 记录请求结束，ttft为0表示不是流式请求或没有收到事件
+func (s *targetStats) end(err error, latency, ttft time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.InFlight--
+	if err != nil {
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, ErrHedgeLost) {
+			s.stats.Failures++
+			s.stats.ConsecutiveFailures++
+			s.stats.LastFailure = time.Now()
+		}
+		return
+	}
+	s.stats.ConsecutiveFailures = 0
+	s.stats.Latency = ewma(s.stats.Latency, latency)
+	if ttft > 0 {
+		s.stats.TTFT = ewma(s.stats.TTFT, ttft)
+	}
+}
+
+// abort 记录被调用方中止的请求，上游没有出错，不计入失败也不计入耗时
+func (s *targetStats) abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.InFlight--
+}
+
+// ewma 计算新的EWMA，没有历史值时直接使用观测值
+func ewma(current, observed time.Duration) time.Duration {
+	if current == 0 {
+		return observed
+	}
+	return time.Duration(ewmaAlpha*float64(observed) + (1-ewmaAlpha)*float64(current))
+}
+
+// Stats 返回目标的观测统计
+func (t *Target) Stats() TargetStats {
+	return t.stats.snapshot()
+}
+
+// do 向目标发送非流式请求并记录统计
+func (t *Target) do(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	t.stats.begin()
+	start := time.Now()
+	resp, err := t.provider.Do(ctx, requestFor(req, t))
+	t.stats.end(err, time.Since(start), 0)
+	return resp, err
+}
+
+// doStream 向目标发送流式请求并记录统计
+func (t *Target) doStream(ctx context.Context, req *provider.ChatRequest, callback func(event provider.StreamEvent) error) error {
+	t.stats.begin()
+	start := time.Now()
+	var ttft time.Duration
+	var callbackErr error
+	err := t.provider.DoStream(ctx, requestFor(req, t), func(event provider.StreamEvent) error {
+		if ttft == 0 && isContentEvent(event) {
+			ttft = time.Since(start)
+		}
+		callbackErr = callback(event)
+		return callbackErr
+	})
+	if callbackErr != nil && errors.Is(err, callbackErr) {
+		t.stats.abort()
+		return err
+	}
+	t.stats.end(err, time.Since(start), ttft)
+	return err
+}
+
+// isContentEvent 判断事件是否为模型生成的内容，StreamEventStart在收到响应头时即发送，不代表已生成内容
+func isContentEvent(event provider.StreamEvent) bool {
+	switch event.Type {
+	case provider.StreamEventText, provider.StreamEventReasoning, provider.StreamEventToolCall:
+		return true
+	default:
+		return false
+	}
+}
+
+// sortedBy 按key升序稳定排序，返回新的切片
+func sortedBy[K cmp.Ordered](targets []*Target, key func(t *Target) K) []*Target {
+	ordered := slices.Clone(targets)
+	slices.SortStableFunc(ordered, func(a, b *Target) int {
+		return cmp.Compare(key(a), key(b))
+	})
+	return ordered
+}
+
+// weightedBalancer 按权重随机排序（Efraimidis-Spirakis加权抽样），权重越大越可能排在前面
+// 权重为0的目标只作为回退，始终按配置顺序排在其他目标之后
+func weightedBalancer(targets []*Target) []*Target {
+	keys := make(map[*Target]float64, len(targets))
+	for _, t := range targets {
+		if t.Weight <= 0 {
+			keys[t] = 0
+			continue
+		}
+		keys[t] = -math.Pow(rand.Float64(), 1/float64(t.Weight))
+	}
+	return sortedBy(targets, func(t *Target) float64 { return keys[t] })
+}
+
+// leastInFlightBalancer 按进行中的请求数升序排序
+func leastInFlightBalancer(targets []*Target) []*Target {
+	return sortedBy(targets, func(t *Target) int64 { return t.Stats().InFlight })
+}
+
+// latencyBalancer 按EWMA延迟升序排序，从未请求过的目标排在最前面以便获得数据，最近连续失败的目标排在最后
+func latencyBalancer(targets []*Target) []*Target {
+	return sortedBy(targets, func(t *Target) time.Duration {
+		stats := t.Stats()
+		return penalized(stats, stats.Latency)
+	})
+}
+
+// ttftBalancer 按EWMA首个内容事件时间升序排序，从未请求过的目标排在最前面以便获得数据，最近连续失败的目标排在最后
+func ttftBalancer(targets []*Target) []*Target {
+	return sortedBy(targets, func(t *Target) time.Duration {
+		stats := t.Stats()
+		return penalized(stats, stats.TTFT)
+	})
+}
+
+// penalized 返回排序用的耗时，最近连续失败的目标返回最大值
+func penalized(stats TargetStats, observed time.Duration) time.Duration {
+	if stats.failing() {
+		return math.MaxInt64
+	}
+	return observed
+}
+
+// cheapestBalancer 按模型的输入与输出单价之和升序排序，只比较与第一个配置了价格的目标币种相同的目标，
+// 其他币种的目标按配置顺序排在其后，未配置价格的目标排在最后
+func cheapestBalancer(targets []*Target) []*Target {
+	pricing := func(t *Target) *domain.ModelPricing {
+		if model := t.Platform.FindModel(t.Model); model != nil {
+			return model.Pricing
+		}
+		return nil
+	}
+	currency, found := "", false
+	for _, t := range targets {
+		if p := pricing(t); p != nil {
+			currency, found = p.Currency, true
+			break
+		}
+	}
+	if !found {
+		return slices.Clone(targets)
+	}
+
+	// rank 返回目标所在的分组和组内排序用的单价
+	rank := func(t *Target) (int, float64) {
+		p := pricing(t)
+		switch {
+		case p == nil:
+			return 2, 0
+		case p.Currency != currency:
+			return 1, 0
+		default:
+			return 0, p.Input + p.Output
+		}
+	}
+	ordered := slices.Clone(targets)
+	slices.SortStableFunc(ordered, func(a, b *Target) int {
+		groupA, priceA := rank(a)
+		groupB, priceB := rank(b)
+		return cmp.Or(cmp.Compare(groupA, groupB), cmp.Compare(priceA, priceB))
+	})
+	return ordered
+}
+
+// defaultBalancers 返回内置的负载均衡策略
+func defaultBalancers() map[string]Balancer {
+	return map[string]Balancer{
+		BalanceWeighted:      BalancerFunc(weightedBalancer),
+		BalanceLeastInFlight: BalancerFunc(leastInFlightBalancer),
+		BalanceLatency:       BalancerFunc(latencyBalancer),
+		BalanceTTFT:          BalancerFunc(ttftBalancer),
+		BalanceCheapest:      BalancerFunc(cheapestBalancer),
+	}
+}
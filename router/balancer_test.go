@@ -0,0 +1,111 @@
+package router
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+)
+
+// testTarget 创建不带Provider的目标，用于测试排序
+func testTarget(id string, weight int, stats TargetStats, pricing *domain.ModelPricing) *Target {
+	platform := &domain.Platform{ID: id, Models: []domain.Model{{Name: "m", Pricing: pricing}}}
+	return &Target{Platform: platform, Model: "m", Weight: weight, stats: &targetStats{stats: stats}}
+}
+
+// targetIDs 返回目标的平台ID
+func targetIDs(targets []*Target) []string {
+	ids := make([]string, 0, len(targets))
+	for _, t := range targets {
+		ids = append(ids, t.Platform.ID)
+	}
+	return ids
+}
+
+func TestWeightedBalancer(t *testing.T) {
+	heavy := testTarget("heavy", 3, TargetStats{}, nil)
+	light := testTarget("light", 1, TargetStats{}, nil)
+	backup1 := testTarget("backup1", 0, TargetStats{}, nil)
+	backup2 := testTarget("backup2", 0, TargetStats{}, nil)
+	targets := []*Target{backup1, light, backup2, heavy}
+
+	const rounds = 4000
+	heavyFirst := 0
+	for range rounds {
+		ordered := weightedBalancer(targets)
+		// 权重为0的目标按配置顺序排在最后
+		if got := targetIDs(ordered[2:]); !slices.Equal(got, []string{"backup1", "backup2"}) {
+			t.Fatalf("排序后最后两个目标为%v，期望[backup1 backup2]", got)
+		}
+		if ordered[0] == heavy {
+			heavyFirst++
+		}
+	}
+	if got := targetIDs(targets); !slices.Equal(got, []string{"backup1", "light", "backup2", "heavy"}) {
+		t.Errorf("传入的切片被修改为%v", got)
+	}
+
+	// 权重3:1时排在最前面的概率约为75%
+	if ratio := float64(heavyFirst) / rounds; ratio < 0.7 || ratio > 0.8 {
+		t.Errorf("权重为3的目标排在最前面的比例为%.3f，期望约0.75", ratio)
+	}
+}
+
+func TestLeastInFlightBalancer(t *testing.T) {
+	targets := []*Target{
+		testTarget("busy", 1, TargetStats{InFlight: 5}, nil),
+		testTarget("idle", 1, TargetStats{}, nil),
+		testTarget("some", 1, TargetStats{InFlight: 2}, nil),
+	}
+	if got := targetIDs(leastInFlightBalancer(targets)); !slices.Equal(got, []string{"idle", "some", "busy"}) {
+		t.Errorf("排序结果为%v，期望[idle some busy]", got)
+	}
+}
+
+func TestLatencyBalancers(t *testing.T) {
+	now := time.Now()
+	stats := map[string]TargetStats{
+		"slow":      {Latency: 300 * time.Millisecond, TTFT: 30 * time.Millisecond},
+		"fast":      {Latency: 100 * time.Millisecond, TTFT: 50 * time.Millisecond},
+		"new":       {},
+		"failing":   {Latency: 10 * time.Millisecond, TTFT: 1 * time.Millisecond, ConsecutiveFailures: 1, LastFailure: now},
+		"recovered": {Latency: 200 * time.Millisecond, TTFT: 40 * time.Millisecond, ConsecutiveFailures: 3, LastFailure: now.Add(-failurePenalty - time.Second)},
+	}
+	targets := make([]*Target, 0, len(stats))
+	for _, id := range []string{"failing", "slow", "new", "recovered", "fast"} {
+		targets = append(targets, testTarget(id, 1, stats[id], nil))
+	}
+
+	// 从未请求过的目标最先，最近连续失败的目标最后，超过failurePenalty的失败不再惩罚
+	if got := targetIDs(latencyBalancer(targets)); !slices.Equal(got, []string{"new", "fast", "recovered", "slow", "failing"}) {
+		t.Errorf("latency排序结果为%v，期望[new fast recovered slow failing]", got)
+	}
+	if got := targetIDs(ttftBalancer(targets)); !slices.Equal(got, []string{"new", "slow", "recovered", "fast", "failing"}) {
+		t.Errorf("ttft排序结果为%v，期望[new slow recovered fast failing]", got)
+	}
+}
+
+func TestCheapestBalancer(t *testing.T) {
+	cny := func(input, output float64) *domain.ModelPricing {
+		return &domain.ModelPricing{Input: input, Output: output, Currency: "CNY"}
+	}
+	targets := []*Target{
+		testTarget("unpriced", 1, TargetStats{}, nil),
+		testTarget("cny-8", 1, TargetStats{}, cny(2, 6)),
+		testTarget("usd-1", 1, TargetStats{}, &domain.ModelPricing{Input: 0.5, Output: 0.5, Currency: "USD"}),
+		testTarget("cny-3", 1, TargetStats{}, cny(1, 2)),
+		testTarget("usd-9", 1, TargetStats{}, &domain.ModelPricing{Input: 4, Output: 5, Currency: "USD"}),
+	}
+
+	// 以第一个配置了价格的目标的币种CNY比较，USD的目标按配置顺序排在其后
+	want := []string{"cny-3", "cny-8", "usd-1", "usd-9", "unpriced"}
+	if got := targetIDs(cheapestBalancer(targets)); !slices.Equal(got, want) {
+		t.Errorf("排序结果为%v，期望%v", got, want)
+	}
+
+	unpriced := []*Target{testTarget("a", 1, TargetStats{}, nil), testTarget("b", 1, TargetStats{}, nil)}
+	if got := targetIDs(cheapestBalancer(unpriced)); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("都未配置价格时排序结果为%v，期望保持配置顺序", got)
+	}
+}
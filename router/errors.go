@@ -0,0 +1,33 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cn-maul/Baize/provider"
+)
+
+// RouteError 路由的所有目标均失败，或某个目标返回了不可回退的错误
+// Unwrap返回最后一次尝试的错误，可通过errors.Is/errors.As判断错误类别
+type RouteError struct {
+	Model    string             // 请求的逻辑模型
+	Attempts []provider.Attempt // 所有尝试，按顺序排列
+}
+
+// Error 实现error接口
+func (e *RouteError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "路由 %s 请求失败，共尝试%d个目标", e.Model, len(e.Attempts))
+	for _, attempt := range e.Attempts {
+		fmt.Fprintf(&b, "; %s/%s: %v", attempt.Platform, attempt.Model, attempt.Err)
+	}
+	return b.String()
+}
+
+// Unwrap 返回最后一次尝试的错误
+func (e *RouteError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
@@ -0,0 +1,268 @@
+package router
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/provider"
+)
+
+// HealthState 目标的健康状态
+type HealthState int
+
+const (
+	// HealthUnknown 尚未探测
+	HealthUnknown HealthState = iota
+	// HealthUp 探测成功
+	HealthUp
+	// HealthDegraded 探测耗时超过阈值，或失败次数尚未达到阈值
+	HealthDegraded
+	// HealthDown 连续失败达到阈值，或平台的熔断器已打开
+	HealthDown
+)
+
+// String 返回健康状态的名称
+func (s HealthState) String() string {
+	switch s {
+	case HealthUp:
+		return "up"
+	case HealthDegraded:
+		return "degraded"
+	case HealthDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// HealthStatus 单个目标（平台、模型）的健康状态快照
+type HealthStatus struct {
+	Platform            string        // 平台ID
+	Model               string        // 模型名称
+	State               HealthState   // 健康状态
+	Latency             time.Duration // 最近一次探测的耗时
+	ConsecutiveFailures int           // 连续探测失败次数
+	LastCheck           time.Time     // 最近一次探测的时间，零值表示尚未探测
+	LastError           error         // 最近一次探测的错误，成功时为nil
+}
+
+// healthConfig 返回平台生效的健康检查配置，平台配置优先于Router的配置，零值字段使用默认值
+func (r *Router) healthConfig(platform *domain.Platform) domain.HealthCheckConfig {
+	var config domain.HealthCheckConfig
+	if platform.HealthCheck != nil {
+		config = *platform.HealthCheck
+	} else if r.opts.HealthCheck != nil {
+		config = *r.opts.HealthCheck
+	}
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Probe == "" {
+		config.Probe = domain.HealthProbeModels
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 2
+	}
+	return config
+}
+
+// StartHealthCheck 启动后台健康检查，每个平台立即探测一次，之后按各自的间隔探测，直到ctx取消
+// 探测请求与普通请求一样经过平台的熔断器：熔断器半开时探测请求即为试探请求，成功后熔断器关闭。
+// 每个Router只启动一次，重复调用不会启动新的探测
+func (r *Router) StartHealthCheck(ctx context.Context) {
+	r.healthOnce.Do(func() {
+		for _, platform := range r.platforms() {
+			go r.healthLoop(ctx, platform)
+		}
+	})
+}
+
+// CheckHealth 立即探测所有平台并等待探测完成
+func (r *Router) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, platform := range r.platforms() {
+		wg.Add(1)
+		go func(platform *domain.Platform) {
+			defer wg.Done()
+			r.probePlatform(ctx, platform)
+		}(platform)
+	}
+	wg.Wait()
+}
+
+// Health 返回所有已探测或已被路由引用的目标的健康状态，按平台和模型排序
+func (r *Router) Health() []HealthStatus {
+	r.statsMu.Lock()
+	all := make([]*targetStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		all = append(all, s)
+	}
+	r.statsMu.Unlock()
+
+	statuses := make([]HealthStatus, 0, len(all))
+	for _, s := range all {
+		statuses = append(statuses, s.healthSnapshot())
+	}
+	slices.SortFunc(statuses, func(a, b HealthStatus) int {
+		return cmp.Or(cmp.Compare(a.Platform, b.Platform), cmp.Compare(a.Model, b.Model))
+	})
+	return statuses
+}
+
+// Health 返回目标的健康状态
+func (t *Target) Health() HealthStatus {
+	return t.stats.healthSnapshot()
+}
+
+// platforms 返回所有创建了Provider的平台
+func (r *Router) platforms() []*domain.Platform {
+	platforms := make([]*domain.Platform, 0, len(r.providers))
+	for platform := range r.providers {
+		platforms = append(platforms, platform)
+	}
+	return platforms
+}
+
+// healthLoop 按间隔探测平台，直到ctx取消
+func (r *Router) healthLoop(ctx context.Context, platform *domain.Platform) {
+	ticker := time.NewTicker(r.healthConfig(platform).Interval)
+	defer ticker.Stop()
+	for {
+		r.probePlatform(ctx, platform)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probePlatform 按平台的探测方式探测一次并更新健康状态
+// chat方式只探测声明了能力且不是向量化模型的模型，能力未知的模型可能无法对话，探测失败会误判为不可用
+func (r *Router) probePlatform(ctx context.Context, platform *domain.Platform) {
+	config := r.healthConfig(platform)
+	prov := r.providers[platform]
+
+	if config.Probe == domain.HealthProbeChat {
+		for _, model := range platform.Models {
+			if model.Capabilities == nil || model.Capabilities.Embeddings {
+				continue
+			}
+			req := &provider.ChatRequest{
+				Model:     model.Name,
+				Messages:  []provider.Message{{Role: "user", Content: "ping"}},
+				MaxTokens: 1,
+				Priority:  provider.PriorityBatch,
+			}
+			latency, err := probe(ctx, config.Timeout, func(ctx context.Context) error {
+				_, err := prov.Do(ctx, req)
+				return err
+			})
+			r.recordHealth(ctx, platform, model.Name, config, latency, err)
+		}
+		return
+	}
+
+	lister, ok := prov.(provider.ModelLister)
+	if !ok {
+		r.logger.Debug("平台 %s 不支持获取模型列表，跳过健康检查", platform.ID)
+		return
+	}
+	latency, err := probe(ctx, config.Timeout, func(ctx context.Context) error {
+		_, err := lister.ListModels(ctx)
+		return err
+	})
+	for _, model := range platform.Models {
+		r.recordHealth(ctx, platform, model.Name, config, latency, err)
+	}
+}
+
+// probe 在超时时间内执行一次探测，返回耗时和错误
+func probe(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := fn(ctx)
+	return time.Since(start), err
+}
+
+// recordHealth 记录探测结果
+// 调用方取消的探测、客户端限流和并发限制导致的失败与上游无关，不更新健康状态
+func (r *Router) recordHealth(ctx context.Context, platform *domain.Platform, model string, config domain.HealthCheckConfig, latency time.Duration, err error) {
+	if ctx.Err() != nil || errors.Is(err, provider.ErrLocalRateLimit) || errors.Is(err, provider.ErrConcurrencyLimit) {
+		return
+	}
+
+	previous, current := r.statsFor(platform, model).recordHealth(config, latency, err)
+	if previous == current {
+		return
+	}
+	if current == HealthUp {
+		r.logger.Info("目标 %s/%s 健康状态: %s -> %s，耗时: %v", platform.ID, model, previous, current, latency)
+	} else {
+		r.logger.Warn("目标 %s/%s 健康状态: %s -> %s，错误: %v", platform.ID, model, previous, current, err)
+	}
+}
+
+// healthSnapshot 返回健康状态快照
+func (s *targetStats) healthSnapshot() HealthStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.health
+	status.Platform = s.stats.Platform
+	status.Model = s.stats.Model
+	return status
+}
+
+// recordHealth 根据探测结果更新健康状态，返回更新前后的状态
+func (s *targetStats) recordHealth(config domain.HealthCheckConfig, latency time.Duration, err error) (HealthState, HealthState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.health.State
+	s.health.Latency = latency
+	s.health.LastCheck = time.Now()
+	s.health.LastError = err
+	switch {
+	case err == nil:
+		s.health.ConsecutiveFailures = 0
+		s.health.State = HealthUp
+		if config.DegradedLatency > 0 && latency > config.DegradedLatency {
+			s.health.State = HealthDegraded
+		}
+	default:
+		s.health.ConsecutiveFailures++
+		s.health.State = HealthDegraded
+		if s.health.ConsecutiveFailures >= config.FailureThreshold || errors.Is(err, provider.ErrCircuitOpen) {
+			s.health.State = HealthDown
+		}
+	}
+	return previous, s.health.State
+}
+
+// demoteUnhealthy 将降级和不可用的目标移到健康目标之后，同一状态的目标保持原顺序
+// 不可用的目标仍保留在最后，以免健康检查误判时所有请求都失败
+func demoteUnhealthy(targets []*Target) []*Target {
+	rank := func(t *Target) int {
+		switch t.Health().State {
+		case HealthDegraded:
+			return 1
+		case HealthDown:
+			return 2
+		default:
+			return 0
+		}
+	}
+	if !slices.ContainsFunc(targets, func(t *Target) bool { return rank(t) > 0 }) {
+		return targets
+	}
+	return sortedBy(targets, rank)
+}
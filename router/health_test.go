@@ -0,0 +1,139 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+	"github.com/cn-maul/Baize/provider"
+)
+
+func TestTargetStatsRecordHealth(t *testing.T) {
+	config := domain.HealthCheckConfig{DegradedLatency: 100 * time.Millisecond, FailureThreshold: 2}
+	errProbe := fmt.Errorf("探测失败: %w", provider.ErrServer)
+
+	steps := []struct {
+		name     string
+		latency  time.Duration
+		err      error
+		want     HealthState
+		failures int
+	}{
+		{"up", 10 * time.Millisecond, nil, HealthUp, 0},
+		{"slow", 200 * time.Millisecond, nil, HealthDegraded, 0},
+		{"first_failure", 10 * time.Millisecond, errProbe, HealthDegraded, 1},
+		{"threshold", 10 * time.Millisecond, errProbe, HealthDown, 2},
+		{"recovered", 10 * time.Millisecond, nil, HealthUp, 0},
+		{"circuit_open", 0, provider.ErrCircuitOpen, HealthDown, 1},
+	}
+	s := &targetStats{}
+	for _, step := range steps {
+		_, state := s.recordHealth(config, step.latency, step.err)
+		health := s.healthSnapshot()
+		if state != step.want || health.State != step.want || health.ConsecutiveFailures != step.failures {
+			t.Fatalf("%s: 状态为%s，连续失败%d次，期望%s、%d次", step.name, health.State, health.ConsecutiveFailures, step.want, step.failures)
+		}
+		if !errors.Is(health.LastError, step.err) || health.Latency != step.latency || health.LastCheck.IsZero() {
+			t.Fatalf("%s: 探测记录为%+v，与探测结果不一致", step.name, health)
+		}
+	}
+}
+
+func TestRouterRecordHealthIgnoresLocalErrors(t *testing.T) {
+	r := &Router{stats: make(map[string]*targetStats), logger: utils.NewLogger(utils.FatalLevel)}
+	platform := &domain.Platform{ID: "p"}
+	config := domain.HealthCheckConfig{FailureThreshold: 1}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.recordHealth(canceled, platform, "m", config, 0, context.Canceled)
+	r.recordHealth(context.Background(), platform, "m", config, 0, fmt.Errorf("限流: %w", provider.ErrLocalRateLimit))
+	r.recordHealth(context.Background(), platform, "m", config, 0, fmt.Errorf("排队: %w", provider.ErrConcurrencyLimit))
+	if health := r.statsFor(platform, "m").healthSnapshot(); health.State != HealthUnknown || !health.LastCheck.IsZero() {
+		t.Fatalf("本地原因导致的探测失败更新了健康状态: %+v", health)
+	}
+
+	r.recordHealth(context.Background(), platform, "m", config, 0, provider.ErrServer)
+	if health := r.statsFor(platform, "m").healthSnapshot(); health.State != HealthDown {
+		t.Fatalf("上游失败后状态为%s，期望down", health.State)
+	}
+}
+
+func TestDemoteUnhealthy(t *testing.T) {
+	states := map[string]HealthState{
+		"down1":    HealthDown,
+		"up":       HealthUp,
+		"degraded": HealthDegraded,
+		"unknown":  HealthUnknown,
+		"down2":    HealthDown,
+	}
+	var targets []*Target
+	for _, id := range []string{"down1", "up", "degraded", "unknown", "down2"} {
+		target := testTarget(id, 1, TargetStats{}, nil)
+		target.stats.health.State = states[id]
+		targets = append(targets, target)
+	}
+
+	// 同一状态的目标保持原顺序，未探测的目标视为健康
+	want := []string{"up", "unknown", "degraded", "down1", "down2"}
+	if got := targetIDs(demoteUnhealthy(targets)); !slices.Equal(got, want) {
+		t.Errorf("排序结果为%v，期望%v", got, want)
+	}
+	if got := targetIDs(targets); got[0] != "down1" {
+		t.Errorf("传入的切片被修改为%v", got)
+	}
+}
+
+func TestChatProbeSkipsUnknownModels(t *testing.T) {
+	u := startUpstream(t, &testUpstream{text: "pong"})
+	r := newTestRouter(t, &domain.Route{Targets: []string{"a/m"}}, map[string]*testUpstream{"a": u})
+	platform := r.config.Platforms["a"]
+	platform.HealthCheck = &domain.HealthCheckConfig{Probe: domain.HealthProbeChat}
+	platform.Models = []domain.Model{
+		{Name: "m", Capabilities: &domain.ModelCapabilities{Tools: true}},
+		{Name: "embedding", Capabilities: &domain.ModelCapabilities{Embeddings: true}},
+		{Name: "unknown"},
+	}
+
+	r.CheckHealth(context.Background())
+	if calls := u.calls.Load(); calls != 1 {
+		t.Fatalf("平台收到%d个探测请求，期望只探测声明了能力的对话模型", calls)
+	}
+	for _, health := range r.Health() {
+		want := HealthUnknown
+		if health.Model == "m" {
+			want = HealthUp
+		}
+		if health.State != want {
+			t.Errorf("模型%s的状态为%s，期望%s", health.Model, health.State, want)
+		}
+	}
+}
+
+func TestStartHealthCheckOnce(t *testing.T) {
+	u := startUpstream(t, &testUpstream{})
+	r := newTestRouter(t, &domain.Route{Targets: []string{"a/m"}}, map[string]*testUpstream{"a": u},
+		WithHealthCheck(domain.HealthCheckConfig{Interval: time.Hour}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.StartHealthCheck(ctx)
+	r.StartHealthCheck(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for r.Health()[0].LastCheck.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待健康检查超时")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if calls := u.calls.Load(); calls != 1 {
+		t.Errorf("平台收到%d个探测请求，期望重复调用StartHealthCheck只启动一次", calls)
+	}
+}
@@ -0,0 +1,249 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/provider"
+)
+
+// ErrHedgeLost 对冲请求中落后的目标被取消时记录在Attempt中的错误
+var ErrHedgeLost = errors.New("对冲请求落后，已取消")
+
+// hedgePolicy 返回模型对应的对冲配置，未启用对冲时返回false
+func (r *Router) hedgePolicy(model string, targets []*Target) (domain.HedgeConfig, bool) {
+	if len(targets) < 2 {
+		return domain.HedgeConfig{}, false
+	}
+	policy := r.opts.Hedge
+	if route, ok := r.config.Routes[model]; ok && route != nil && route.Hedge != nil {
+		policy = route.Hedge
+	}
+	if policy == nil || policy.Delay <= 0 {
+		return domain.HedgeConfig{}, false
+	}
+	hedge := *policy
+	if hedge.MaxParallel < 2 {
+		hedge.MaxParallel = 2
+	}
+	return hedge, true
+}
+
+// hedgeRun 对单个目标发起请求；claim在目标产生可用结果时调用，返回true表示该目标胜出，同时返回当时的尝试记录
+type hedgeRun func(ctx context.Context, target *Target, claim func() ([]provider.Attempt, bool)) error
+
+// hedgeResult 单个对冲请求的结果
+type hedgeResult struct {
+	index int
+	err   error
+}
+
+// hedger 一次对冲请求的状态
+type hedger struct {
+	mu       sync.Mutex
+	targets  []*Target
+	starts   []time.Time
+	cancels  []context.CancelFunc
+	winner   int
+	attempts []provider.Attempt
+}
+
+// claim 尝试让第index个目标胜出，成功时取消其他目标，并返回已结束的尝试加上胜出目标的记录
+func (h *hedger) claim(index int) ([]provider.Attempt, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.winner >= 0 {
+		return nil, false
+	}
+	h.winner = index
+	for i, cancel := range h.cancels {
+		if i != index && cancel != nil {
+			cancel()
+		}
+	}
+	return slices.Concat(h.attempts, []provider.Attempt{h.attempt(index, nil)}), true
+}
+
+// attempt 构造第index个目标的尝试记录
+func (h *hedger) attempt(index int, err error) provider.Attempt {
+	return provider.Attempt{
+		Platform: h.targets[index].Platform.ID,
+		Model:    h.targets[index].Model,
+		Latency:  time.Since(h.starts[index]),
+		Err:      err,
+	}
+}
+
+// runHedged 按对冲策略依次向目标发起请求
+// 第一个目标发出后，每隔Delay没有目标胜出就发出下一个目标；目标失败且可回退时立即发出下一个目标。
+// 某个目标胜出后取消其他目标，等待所有请求结束后返回尝试记录，胜出目标为最后一项
+func (r *Router) runHedged(ctx context.Context, model string, targets []*Target, policy domain.HedgeConfig, run hedgeRun) ([]provider.Attempt, error) {
+	h := &hedger{
+		targets: targets,
+		starts:  make([]time.Time, len(targets)),
+		cancels: make([]context.CancelFunc, len(targets)),
+		winner:  -1,
+	}
+	results := make(chan hedgeResult, len(targets))
+	launched, running := 0, 0
+	launch := func() {
+		index := launched
+		targetCtx, cancel := context.WithCancel(ctx)
+		h.mu.Lock()
+		h.starts[index] = time.Now()
+		h.cancels[index] = cancel
+		h.mu.Unlock()
+		launched++
+		running++
+		go func() {
+			defer cancel()
+			err := run(targetCtx, targets[index], func() ([]provider.Attempt, bool) { return h.claim(index) })
+			results <- hedgeResult{index: index, err: err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(policy.Delay)
+	defer timer.Stop()
+
+	var winnerErr error
+	var winnerAttempt, fatalAttempt *provider.Attempt
+	stop := false
+	for running > 0 {
+		select {
+		case <-timer.C:
+			h.mu.Lock()
+			decided := h.winner >= 0
+			h.mu.Unlock()
+			if !decided && !stop && launched < len(targets) && running < policy.MaxParallel {
+				r.logger.Info("目标 %s/%s 在%v内没有响应，发出对冲请求", targets[launched-1].Platform.ID, targets[launched-1].Model, policy.Delay)
+				launch()
+				timer.Reset(policy.Delay)
+			}
+		case res := <-results:
+			running--
+			h.mu.Lock()
+			winner := h.winner
+			attempt := h.attempt(res.index, res.err)
+			if res.index == winner {
+				winnerErr = res.err
+				winnerAttempt = &attempt
+				h.mu.Unlock()
+				continue
+			}
+			// 只有被取消的落选请求记为ErrHedgeLost，在取消前已经失败的保留原始错误
+			if winner >= 0 && ctx.Err() == nil && errors.Is(res.err, context.Canceled) {
+				attempt.Err = ErrHedgeLost
+			}
+			if winner >= 0 || stop {
+				h.attempts = append(h.attempts, attempt)
+				h.mu.Unlock()
+				continue
+			}
+			if !r.shouldFallback(ctx, res.err) {
+				// 不可回退的错误，取消其他目标，该错误作为最后一项返回
+				stop = true
+				fatalAttempt = &attempt
+				for _, cancel := range h.cancels[:launched] {
+					cancel()
+				}
+				h.mu.Unlock()
+				continue
+			}
+			h.attempts = append(h.attempts, attempt)
+			h.mu.Unlock()
+
+			if launched < len(targets) {
+				r.logger.Warn("目标 %s/%s 请求失败，发出下一个请求: %v", targets[res.index].Platform.ID, targets[res.index].Model, res.err)
+				launch()
+				timer.Reset(policy.Delay)
+			}
+		}
+	}
+
+	if winnerAttempt == nil {
+		attempts := h.attempts
+		if fatalAttempt != nil {
+			attempts = append(attempts, *fatalAttempt)
+		}
+		return attempts, &RouteError{Model: model, Attempts: attempts}
+	}
+	attempts := append(h.attempts, *winnerAttempt)
+	if winnerErr != nil {
+		// 胜出目标已开始输出后失败，错误原样返回
+		return attempts, winnerErr
+	}
+	return attempts, nil
+}
+
+// doHedged 以对冲方式发送非流式请求，第一个成功返回完整响应的目标胜出
+func (r *Router) doHedged(ctx context.Context, model string, req *provider.ChatRequest, targets []*Target, policy domain.HedgeConfig) (*provider.ChatResponse, error) {
+	var resp *provider.ChatResponse
+	attempts, err := r.runHedged(ctx, model, targets, policy, func(ctx context.Context, target *Target, claim func() ([]provider.Attempt, bool)) error {
+		result, err := target.do(ctx, req)
+		if err != nil {
+			return err
+		}
+		if _, ok := claim(); !ok {
+			return ErrHedgeLost
+		}
+		resp = result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Attempts = attempts
+	return resp, nil
+}
+
+// doStreamHedged 以对冲方式发送流式请求，第一个产生内容（文本、推理或工具调用）事件的目标胜出，其余目标被取消
+// 胜出前的StreamEventStart等事件先缓存，胜出时再转发；流结束时仍没有内容的目标在结束时胜出。
+// 胜出前各目标的错误事件不会转发，失败原因通过返回的RouteError获取
+func (r *Router) doStreamHedged(ctx context.Context, model string, req *provider.ChatRequest, targets []*Target, policy domain.HedgeConfig, callback func(event provider.StreamEvent) error) error {
+	_, err := r.runHedged(ctx, model, targets, policy, func(ctx context.Context, target *Target, claim func() ([]provider.Attempt, bool)) error {
+		started := false
+		var pending []provider.StreamEvent
+		// start 让目标胜出并转发缓存的事件
+		start := func() error {
+			attempts, ok := claim()
+			if !ok {
+				return ErrHedgeLost
+			}
+			started = true
+			for _, event := range pending {
+				if event.Type == provider.StreamEventStart {
+					event.Attempts = attempts
+				}
+				if err := callback(event); err != nil {
+					return err
+				}
+			}
+			pending = nil
+			return nil
+		}
+
+		err := target.doStream(ctx, req, func(event provider.StreamEvent) error {
+			if started {
+				return callback(event)
+			}
+			if event.Type == provider.StreamEventError {
+				return nil
+			}
+			pending = append(pending, event)
+			if isContentEvent(event) {
+				return start()
+			}
+			return nil
+		})
+		if err == nil && !started {
+			err = start()
+		}
+		return err
+	})
+	return err
+}
@@ -0,0 +1,156 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/provider"
+)
+
+// hedgeRoute 依次尝试a、b两个平台并在delay后对冲的路由
+func hedgeRoute(delay time.Duration) *domain.Route {
+	return &domain.Route{Targets: []string{"a/m", "b/m"}, Hedge: &domain.HedgeConfig{Delay: delay}}
+}
+
+func TestHedgeNotTriggeredBeforeDelay(t *testing.T) {
+	a := startUpstream(t, &testUpstream{text: "a"})
+	b := startUpstream(t, &testUpstream{text: "b"})
+	r := newTestRouter(t, hedgeRoute(time.Second), map[string]*testUpstream{"a": a, "b": b})
+
+	resp, err := r.Do(context.Background(), chatRequest())
+	if err != nil {
+		t.Fatalf("Do失败: %v", err)
+	}
+	if resp.Text() != "a" || b.calls.Load() != 0 {
+		t.Errorf("响应为%q，b收到%d个请求，期望第一个目标在Delay内响应时不发出对冲请求", resp.Text(), b.calls.Load())
+	}
+}
+
+func TestHedgeDelayTrigger(t *testing.T) {
+	a := startUpstream(t, &testUpstream{text: "a", delay: time.Second})
+	b := startUpstream(t, &testUpstream{text: "b"})
+	r := newTestRouter(t, hedgeRoute(20*time.Millisecond), map[string]*testUpstream{"a": a, "b": b})
+
+	start := time.Now()
+	resp, err := r.Do(context.Background(), chatRequest())
+	if err != nil {
+		t.Fatalf("Do失败: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Do耗时%v，期望对冲请求先返回", elapsed)
+	}
+	if resp.Text() != "b" {
+		t.Errorf("响应为%q，期望对冲目标b胜出", resp.Text())
+	}
+
+	// 胜出目标为最后一项，落后的目标记为ErrHedgeLost
+	if got := attemptPlatforms(resp.Attempts); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("尝试记录为%v，期望[a b]", got)
+	}
+	if err := resp.Attempts[0].Err; !errors.Is(err, ErrHedgeLost) {
+		t.Errorf("落后目标的错误为%v，期望ErrHedgeLost", err)
+	}
+	if err := resp.Attempts[1].Err; err != nil {
+		t.Errorf("胜出目标的错误为%v，期望nil", err)
+	}
+}
+
+func TestHedgeFallbackLaunchesNextImmediately(t *testing.T) {
+	a := startUpstream(t, &testUpstream{status: 500, errBody: `{"error":{"message":"internal error","type":"server_error"}}`})
+	b := startUpstream(t, &testUpstream{text: "b"})
+	r := newTestRouter(t, hedgeRoute(time.Second), map[string]*testUpstream{"a": a, "b": b})
+
+	start := time.Now()
+	resp, err := r.Do(context.Background(), chatRequest())
+	if err != nil {
+		t.Fatalf("Do失败: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Do耗时%v，期望失败后立即发出下一个请求而不等待Delay", elapsed)
+	}
+	if got := attemptPlatforms(resp.Attempts); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("尝试记录为%v，期望[a b]", got)
+	}
+	if err := resp.Attempts[0].Err; !errors.Is(err, provider.ErrServer) {
+		t.Errorf("失败目标的错误为%v，期望保留原始错误ErrServer", err)
+	}
+}
+
+func TestHedgeNonFallbackErrorStops(t *testing.T) {
+	a := startUpstream(t, &testUpstream{status: 400, errBody: `{"error":{"message":"bad request","type":"invalid_request_error"}}`})
+	b := startUpstream(t, &testUpstream{text: "b"})
+	r := newTestRouter(t, hedgeRoute(time.Second), map[string]*testUpstream{"a": a, "b": b})
+
+	_, err := r.Do(context.Background(), chatRequest())
+	var routeErr *RouteError
+	if !errors.As(err, &routeErr) || !errors.Is(err, provider.ErrBadRequest) {
+		t.Fatalf("Do返回%v，期望包装ErrBadRequest的RouteError", err)
+	}
+	if got := attemptPlatforms(routeErr.Attempts); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("尝试记录为%v，期望[a]", got)
+	}
+	if calls := b.calls.Load(); calls != 0 {
+		t.Errorf("b收到%d个请求，期望不可回退的错误停止对冲", calls)
+	}
+}
+
+func TestHedgeNonFallbackErrorCancelsRunning(t *testing.T) {
+	a := startUpstream(t, &testUpstream{text: "a", delay: time.Second})
+	b := startUpstream(t, &testUpstream{status: 401, errBody: `{"error":{"message":"invalid key","type":"invalid_request_error","code":"invalid_api_key"}}`})
+	r := newTestRouter(t, hedgeRoute(20*time.Millisecond), map[string]*testUpstream{"a": a, "b": b})
+
+	start := time.Now()
+	_, err := r.Do(context.Background(), chatRequest())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Do耗时%v，期望不可回退的错误取消进行中的目标", elapsed)
+	}
+	var routeErr *RouteError
+	if !errors.As(err, &routeErr) || !errors.Is(err, provider.ErrAuthentication) {
+		t.Fatalf("Do返回%v，期望以ErrAuthentication结尾的RouteError", err)
+	}
+	// 被取消的目标保留取消错误，不可回退的错误作为最后一项
+	if got := attemptPlatforms(routeErr.Attempts); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("尝试记录为%v，期望[a b]", got)
+	}
+	if err := routeErr.Attempts[0].Err; errors.Is(err, ErrHedgeLost) || !errors.Is(err, context.Canceled) {
+		t.Errorf("被取消目标的错误为%v，期望context.Canceled", err)
+	}
+}
+
+func TestHedgeStreamClaimsOnFirstContent(t *testing.T) {
+	// a立即发送开始事件，但内容在Delay之后才到达
+	a := startUpstream(t, &testUpstream{text: "a", delay: time.Second})
+	b := startUpstream(t, &testUpstream{text: "b"})
+	r := newTestRouter(t, hedgeRoute(20*time.Millisecond), map[string]*testUpstream{"a": a, "b": b})
+
+	var events []provider.StreamEvent
+	err := r.DoStream(context.Background(), chatRequest(), func(event provider.StreamEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DoStream失败: %v", err)
+	}
+
+	var text string
+	starts := 0
+	for _, event := range events {
+		switch event.Type {
+		case provider.StreamEventStart:
+			starts++
+			// 开始事件在胜出时转发，尝试记录的最后一项为胜出目标
+			if got := attemptPlatforms(event.Attempts); !slices.Equal(got, []string{"b"}) {
+				t.Errorf("开始事件的尝试记录为%v，期望[b]", got)
+			}
+		case provider.StreamEventText:
+			text += event.Text
+		}
+	}
+	if starts != 1 || text != "b" {
+		t.Errorf("收到%d个开始事件和文本%q，期望只转发胜出目标b的事件", starts, text)
+	}
+}
@@ -0,0 +1,80 @@
+package router
+
+import (
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+	"github.com/cn-maul/Baize/provider"
+)
+
+// Options 定义了Router的配置选项
+type Options struct {
+	ProviderOptions []provider.ProviderOption // 创建各平台Provider时使用的选项
+	ShouldFallback  func(err error) bool      // 判断失败后是否尝试下一个目标，默认为provider.IsRetryable
+	Hedge           *domain.HedgeConfig       // 路由未配置hedge时使用的对冲配置，nil表示不对冲
+	Balancers       map[string]Balancer       // 可用的负载均衡策略，键为策略名称
+	DefaultBalance  string                    // 多个平台提供同一模型且没有路由时使用的策略，默认为latency
+	HealthCheck     *domain.HealthCheckConfig // 平台未配置health_check时使用的健康检查配置，nil表示使用默认值
+	LogLevel        utils.LogLevel
+}
+
+// Option 定义了Option模式的函数类型
+type Option func(*Options)
+
+// WithProviderOptions 设置创建各平台Provider时使用的选项
+func WithProviderOptions(options ...provider.ProviderOption) Option {
+	return func(opts *Options) {
+		opts.ProviderOptions = append(opts.ProviderOptions, options...)
+	}
+}
+
+// WithFallbackPolicy 设置判断是否回退到下一个目标的函数
+func WithFallbackPolicy(shouldFallback func(err error) bool) Option {
+	return func(opts *Options) {
+		opts.ShouldFallback = shouldFallback
+	}
+}
+
+// WithHedging 为所有未单独配置hedge的路由启用对冲请求
+func WithHedging(config domain.HedgeConfig) Option {
+	return func(opts *Options) {
+		opts.Hedge = &config
+	}
+}
+
+// WithBalancer 注册自定义的负载均衡策略，可在路由的balance中按名称引用，同名时覆盖内置策略
+func WithBalancer(name string, balancer Balancer) Option {
+	return func(opts *Options) {
+		opts.Balancers[name] = balancer
+	}
+}
+
+// WithDefaultBalance 设置多个平台提供同一模型且没有路由时使用的负载均衡策略
+func WithDefaultBalance(name string) Option {
+	return func(opts *Options) {
+		opts.DefaultBalance = name
+	}
+}
+
+// WithHealthCheck 设置平台未单独配置health_check时使用的健康检查配置，健康检查需通过Router.StartHealthCheck启动
+func WithHealthCheck(config domain.HealthCheckConfig) Option {
+	return func(opts *Options) {
+		opts.HealthCheck = &config
+	}
+}
+
+// WithLogLevel 设置日志级别
+func WithLogLevel(logLevel utils.LogLevel) Option {
+	return func(opts *Options) {
+		opts.LogLevel = logLevel
+	}
+}
+
+// getDefaultOptions 获取默认的Options
+func getDefaultOptions() *Options {
+	return &Options{
+		ShouldFallback: provider.IsRetryable,
+		Balancers:      defaultBalancers(),
+		DefaultBalance: BalanceLatency,
+		LogLevel:       utils.InfoLevel,
+	}
+}
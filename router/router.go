@@ -0,0 +1,318 @@
+package router
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cn-maul/Baize/config"
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+	"github.com/cn-maul/Baize/provider"
+)
+
+// Target 路由目标，即提供模型的平台和实际模型名称
+type Target struct {
+	Platform *domain.Platform
+	Model    string
+	Weight   int // 权重，用于weighted负载均衡策略
+	provider provider.AIProvider
+	stats    *targetStats
+}
+
+// Router 多平台路由器，实现了provider.AIProvider接口
+// 请求先按配置文件rules中的路由规则选择目标，请求的模型或规则的目标可以是routes中定义的逻辑模型，
+// 也可以是config.ResolveModel支持的任意模型引用；
+// 逻辑模型的目标按顺序尝试，失败且错误可回退时尝试下一个目标；启用对冲时见HedgeConfig
+type Router struct {
+	config    *domain.Config
+	routes    map[string][]*Target
+	providers map[*domain.Platform]provider.AIProvider
+	opts      *Options
+	logger    *utils.Logger
+
+	// 按"平台ID/模型"记录的观测统计
+	statsMu sync.Mutex
+	stats   map[string]*targetStats
+
+	healthOnce sync.Once // 保证后台健康检查只启动一次
+}
+
+// New 根据配置创建Router，为每个平台创建Provider并解析所有路由
+func New(cfg *domain.Config, options ...Option) (*Router, error) {
+	opts := getDefaultOptions()
+	for _, option := range options {
+		option(opts)
+	}
+
+	r := &Router{
+		config:    cfg,
+		routes:    make(map[string][]*Target, len(cfg.Routes)),
+		providers: make(map[*domain.Platform]provider.AIProvider, len(cfg.Platforms)),
+		opts:      opts,
+		logger:    utils.NewLogger(opts.LogLevel),
+		stats:     make(map[string]*targetStats),
+	}
+
+	if _, ok := opts.Balancers[opts.DefaultBalance]; !ok && opts.DefaultBalance != "" {
+		return nil, fmt.Errorf("负载均衡策略 %s 不存在", opts.DefaultBalance)
+	}
+
+	for id, platform := range cfg.Platforms {
+		if platform == nil || r.providers[platform] != nil {
+			continue
+		}
+		prov, err := provider.CreateProvider(platform, opts.ProviderOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("创建平台 %s 的Provider失败: %w", id, err)
+		}
+		r.providers[platform] = prov
+	}
+
+	for name, route := range cfg.Routes {
+		if route == nil || len(route.Targets) == 0 {
+			return nil, fmt.Errorf("路由 %s 没有定义目标", name)
+		}
+		if _, ok := opts.Balancers[route.Balance]; !ok && route.Balance != "" {
+			return nil, fmt.Errorf("路由 %s 的负载均衡策略 %s 不存在", name, route.Balance)
+		}
+		targets := make([]*Target, 0, len(route.Targets))
+		for _, ref := range route.Targets {
+			target, err := r.resolveTarget(ref)
+			if err != nil {
+				return nil, fmt.Errorf("路由 %s 的目标 %s 无效: %w", name, ref, err)
+			}
+			if weight, ok := route.Weights[ref]; ok {
+				target.Weight = weight
+			}
+			targets = append(targets, target)
+		}
+		r.routes[name] = targets
+	}
+
+	return r, nil
+}
+
+// Targets 返回模型对应的目标，按尝试顺序排列
+// 路由按其balance策略排序，未配置策略时保持配置顺序；多个平台提供同一模型时按DefaultBalance策略排序
+func (r *Router) Targets(model string) ([]*Target, error) {
+	if targets, ok := r.routes[model]; ok {
+		return r.balance(r.config.Routes[model].Balance, targets), nil
+	}
+
+	candidates, err := config.ResolveModelCandidates(r.config, model)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]*Target, 0, len(candidates))
+	for _, c := range candidates {
+		target, err := r.newTarget(c.Platform, c.Model)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return r.balance(r.opts.DefaultBalance, targets), nil
+}
+
+// balance 按策略对目标排序，策略为空或只有一个目标时保持原顺序；之后将健康检查发现的降级和不可用目标移到最后
+func (r *Router) balance(strategy string, targets []*Target) []*Target {
+	if balancer, ok := r.opts.Balancers[strategy]; ok && len(targets) > 1 {
+		targets = balancer.Order(targets)
+	}
+	return demoteUnhealthy(targets)
+}
+
+// resolveTarget 将模型引用解析为目标
+func (r *Router) resolveTarget(ref string) (*Target, error) {
+	platform, model, err := config.ResolveModel(r.config, ref)
+	if err != nil {
+		return nil, err
+	}
+	return r.newTarget(platform, model)
+}
+
+// newTarget 创建目标，同一平台和模型的目标共享观测统计和健康状态
+func (r *Router) newTarget(platform *domain.Platform, model string) (*Target, error) {
+	prov, ok := r.providers[platform]
+	if !ok {
+		return nil, fmt.Errorf("平台 %s 没有可用的Provider", platform.ID)
+	}
+
+	return &Target{Platform: platform, Model: model, Weight: 1, provider: prov, stats: r.statsFor(platform, model)}, nil
+}
+
+// statsFor 返回平台和模型的观测统计，不存在时创建
+func (r *Router) statsFor(platform *domain.Platform, model string) *targetStats {
+	key := platform.ID + "/" + model
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	stats, ok := r.stats[key]
+	if !ok {
+		stats = &targetStats{stats: TargetStats{Platform: platform.ID, Model: model}}
+		r.stats[key] = stats
+	}
+	return stats
+}
+
+// Stats 返回所有目标的观测统计，按平台和模型排序
+func (r *Router) Stats() []TargetStats {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	stats := make([]TargetStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		stats = append(stats, s.snapshot())
+	}
+	slices.SortFunc(stats, func(a, b TargetStats) int {
+		return cmp.Or(cmp.Compare(a.Platform, b.Platform), cmp.Compare(a.Model, b.Model))
+	})
+	return stats
+}
+
+// requestFor 复制请求并替换为目标的实际模型
+func requestFor(req *provider.ChatRequest, target *Target) *provider.ChatRequest {
+	targetReq := *req
+	targetReq.Model = target.Model
+	return &targetReq
+}
+
+// shouldFallback 判断失败后是否尝试下一个目标，上下文已取消时不再尝试
+func (r *Router) shouldFallback(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && r.opts.ShouldFallback(err)
+}
+
+// Do 实现AIProvider接口的Do方法，按顺序尝试路由的各个目标
+func (r *Router) Do(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("请求不能为空")
+	}
+	model := r.selectModel(req)
+	targets, err := r.Targets(model)
+	if err != nil {
+		return nil, err
+	}
+	if policy, ok := r.hedgePolicy(model, targets); ok {
+		return r.doHedged(ctx, model, req, targets, policy)
+	}
+
+	var attempts []provider.Attempt
+	for i, target := range targets {
+		start := time.Now()
+		resp, err := target.do(ctx, req)
+		attempts = append(attempts, provider.Attempt{
+			Platform: target.Platform.ID,
+			Model:    target.Model,
+			Latency:  time.Since(start),
+			Err:      err,
+		})
+		if err == nil {
+			resp.Attempts = attempts
+			return resp, nil
+		}
+		if i == len(targets)-1 || !r.shouldFallback(ctx, err) {
+			break
+		}
+		r.logger.Warn("目标 %s/%s 请求失败，回退到下一个目标: %v", target.Platform.ID, target.Model, err)
+	}
+	return nil, &RouteError{Model: model, Attempts: attempts}
+}
+
+// DoStream 实现AIProvider接口的DoStream方法
+// 只有在收到第一个事件之前失败才会回退到下一个目标，已经开始输出的流不会切换目标
+func (r *Router) DoStream(ctx context.Context, req *provider.ChatRequest, callback func(event provider.StreamEvent) error) error {
+	if req == nil {
+		return fmt.Errorf("请求不能为空")
+	}
+	model := r.selectModel(req)
+	targets, err := r.Targets(model)
+	if err != nil {
+		return err
+	}
+	if policy, ok := r.hedgePolicy(model, targets); ok {
+		return r.doStreamHedged(ctx, model, req, targets, policy, callback)
+	}
+
+	var attempts []provider.Attempt
+	for i, target := range targets {
+		start := time.Now()
+		started := false
+		// 开始输出前的错误事件暂缓发送，回退时丢弃
+		var pending *provider.StreamEvent
+		err := target.doStream(ctx, req, func(event provider.StreamEvent) error {
+			if !started && event.Type == provider.StreamEventError {
+				pending = &event
+				return nil
+			}
+			if !started {
+				started = true
+				if event.Type == provider.StreamEventStart {
+					event.Attempts = slices.Concat(attempts, []provider.Attempt{{
+						Platform: target.Platform.ID,
+						Model:    target.Model,
+						Latency:  time.Since(start),
+					}})
+				}
+			}
+			return callback(event)
+		})
+		attempts = append(attempts, provider.Attempt{
+			Platform: target.Platform.ID,
+			Model:    target.Model,
+			Latency:  time.Since(start),
+			Err:      err,
+		})
+		if err == nil {
+			return nil
+		}
+		if started {
+			// 已开始输出，错误原样返回，避免把回调返回的错误包装成路由错误
+			return err
+		}
+		if i == len(targets)-1 || !r.shouldFallback(ctx, err) {
+			if pending != nil {
+				if cbErr := callback(*pending); cbErr != nil {
+					return cbErr
+				}
+			}
+			break
+		}
+		r.logger.Warn("目标 %s/%s 流式请求失败，回退到下一个目标: %v", target.Platform.ID, target.Model, err)
+	}
+	return &RouteError{Model: model, Attempts: attempts}
+}
+
+// Chat 实现AIProvider接口的Chat方法
+func (r *Router) Chat(ctx context.Context, model string, msg string) (string, error) {
+	return r.ChatWithContext(ctx, model, []provider.Message{{Role: provider.RoleUser, Content: msg}})
+}
+
+// ChatWithContext 实现AIProvider接口的ChatWithContext方法
+func (r *Router) ChatWithContext(ctx context.Context, model string, messages []provider.Message) (string, error) {
+	resp, err := r.Do(ctx, &provider.ChatRequest{Model: model, Messages: messages})
+	if err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
+}
+
+// ChatStream 实现AIProvider接口的ChatStream方法
+func (r *Router) ChatStream(ctx context.Context, model string, msg string, callback func(chunk string) error) error {
+	return r.ChatStreamWithContext(ctx, model, []provider.Message{{Role: provider.RoleUser, Content: msg}}, callback)
+}
+
+// ChatStreamWithContext 实现AIProvider接口的ChatStreamWithContext方法
+func (r *Router) ChatStreamWithContext(ctx context.Context, model string, messages []provider.Message, callback func(chunk string) error) error {
+	return r.DoStream(ctx, &provider.ChatRequest{Model: model, Messages: messages}, func(event provider.StreamEvent) error {
+		if event.Type != provider.StreamEventText {
+			return nil
+		}
+		return callback(event.Text)
+	})
+}
+
+// 确保Router实现了AIProvider接口
+var _ provider.AIProvider = (*Router)(nil)
@@ -0,0 +1,301 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/pkg/utils"
+	"github.com/cn-maul/Baize/provider"
+)
+
+// testUpstream 模拟的OpenAI兼容平台
+type testUpstream struct {
+	*httptest.Server
+
+	text    string        // 回复内容
+	delay   time.Duration // 非流式响应前、流式响应的开始事件与内容之间的等待时间
+	status  int           // 非0时返回该状态码和errBody
+	errBody string
+	chunks  []string // 非空时作为流式响应的data行原样发送，不追加[DONE]
+
+	calls    atomic.Int32 // 收到的请求数
+	canceled atomic.Int32 // 等待期间被取消的请求数
+}
+
+// startUpstream 启动模拟平台，测试结束时关闭
+func startUpstream(t *testing.T, u *testUpstream) *testUpstream {
+	t.Helper()
+	u.Server = httptest.NewServer(u)
+	t.Cleanup(u.Close)
+	return u
+}
+
+// wait 等待delay，请求被取消时返回false
+func (u *testUpstream) wait(r *http.Request) bool {
+	select {
+	case <-time.After(u.delay):
+		return true
+	case <-r.Context().Done():
+		u.canceled.Add(1)
+		return false
+	}
+}
+
+func (u *testUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.calls.Add(1)
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	if u.status != 0 {
+		w.WriteHeader(u.status)
+		w.Write([]byte(u.errBody))
+		return
+	}
+
+	if !req.Stream {
+		if !u.wait(r) {
+			return
+		}
+		fmt.Fprintf(w, `{"id":"chatcmpl-1","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}]}`, req.Model, u.text)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher := w.(http.Flusher)
+	send := func(data string) {
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	if len(u.chunks) > 0 {
+		for _, chunk := range u.chunks {
+			send(chunk)
+		}
+		return
+	}
+	send(fmt.Sprintf(`{"id":"chatcmpl-1","model":%q,"choices":[{"index":0,"delta":{"role":"assistant"}}]}`, req.Model))
+	if !u.wait(r) {
+		return
+	}
+	send(fmt.Sprintf(`{"choices":[{"index":0,"delta":{"content":%q}}]}`, u.text))
+	send(`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`)
+	send("[DONE]")
+}
+
+// newTestRouter 为每个模拟平台创建提供模型m的openai类型平台，并创建包含路由route的Router
+func newTestRouter(t *testing.T, route *domain.Route, upstreams map[string]*testUpstream, options ...Option) *Router {
+	t.Helper()
+	cfg := &domain.Config{
+		Platforms: make(map[string]*domain.Platform, len(upstreams)),
+		Routes:    map[string]*domain.Route{"chat": route},
+	}
+	for id, u := range upstreams {
+		cfg.Platforms[id] = &domain.Platform{ID: id, Type: "openai", BaseURL: u.URL, APIKey: "sk-test-key", Models: []domain.Model{{Name: "m"}}}
+	}
+
+	options = append([]Option{
+		WithLogLevel(utils.FatalLevel),
+		WithProviderOptions(provider.WithMaxRetries(0), provider.WithLogLevel(utils.FatalLevel)),
+	}, options...)
+	r, err := New(cfg, options...)
+	if err != nil {
+		t.Fatalf("创建Router失败: %v", err)
+	}
+	return r
+}
+
+// chatRequest 请求路由chat的测试请求
+func chatRequest() *provider.ChatRequest {
+	return &provider.ChatRequest{Model: "chat", Messages: []provider.Message{{Role: provider.RoleUser, Content: "hi"}}}
+}
+
+// attemptPlatforms 返回各次尝试的平台ID
+func attemptPlatforms(attempts []provider.Attempt) []string {
+	platforms := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		platforms = append(platforms, attempt.Platform)
+	}
+	return platforms
+}
+
+// fallbackRoute 按顺序尝试a、b两个平台的路由
+func fallbackRoute() *domain.Route {
+	return &domain.Route{Targets: []string{"a/m", "b/m"}}
+}
+
+const (
+	serverErrorBody = `{"error":{"message":"internal error","type":"server_error"}}`
+	badRequestBody  = `{"error":{"message":"invalid temperature","type":"invalid_request_error"}}`
+	authErrorBody   = `{"error":{"message":"invalid key","type":"invalid_request_error","code":"invalid_api_key"}}`
+)
+
+func TestRouterDoFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		fallback bool
+		want     error
+	}{
+		{"server_error", 500, serverErrorBody, true, provider.ErrServer},
+		{"rate_limited", 429, `{"error":{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}}`, true, provider.ErrRateLimited},
+		{"bad_request", 400, badRequestBody, false, provider.ErrBadRequest},
+		{"authentication", 401, authErrorBody, false, provider.ErrAuthentication},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := startUpstream(t, &testUpstream{status: tt.status, errBody: tt.body})
+			b := startUpstream(t, &testUpstream{text: "b"})
+			r := newTestRouter(t, fallbackRoute(), map[string]*testUpstream{"a": a, "b": b})
+
+			resp, err := r.Do(context.Background(), chatRequest())
+			if !tt.fallback {
+				var routeErr *RouteError
+				if !errors.As(err, &routeErr) || !errors.Is(err, tt.want) {
+					t.Fatalf("Do返回%v，期望包装%v的RouteError", err, tt.want)
+				}
+				if got := attemptPlatforms(routeErr.Attempts); !slices.Equal(got, []string{"a"}) {
+					t.Errorf("尝试记录为%v，期望[a]", got)
+				}
+				if calls := b.calls.Load(); calls != 0 {
+					t.Errorf("b收到%d个请求，期望不回退", calls)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Do失败: %v", err)
+			}
+			if resp.Text() != "b" {
+				t.Errorf("响应为%q，期望回退到b", resp.Text())
+			}
+			if got := attemptPlatforms(resp.Attempts); !slices.Equal(got, []string{"a", "b"}) {
+				t.Fatalf("尝试记录为%v，期望[a b]", got)
+			}
+			if !errors.Is(resp.Attempts[0].Err, tt.want) || resp.Attempts[1].Err != nil {
+				t.Errorf("尝试记录的错误为[%v %v]，期望[%v <nil>]", resp.Attempts[0].Err, resp.Attempts[1].Err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterDoAllTargetsFail(t *testing.T) {
+	a := startUpstream(t, &testUpstream{status: 500, errBody: serverErrorBody})
+	b := startUpstream(t, &testUpstream{status: 503, errBody: `{"error":{"message":"overloaded"}}`})
+	r := newTestRouter(t, fallbackRoute(), map[string]*testUpstream{"a": a, "b": b})
+
+	_, err := r.Do(context.Background(), chatRequest())
+	var routeErr *RouteError
+	if !errors.As(err, &routeErr) {
+		t.Fatalf("Do返回%v，期望RouteError", err)
+	}
+	if got := attemptPlatforms(routeErr.Attempts); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("尝试记录为%v，期望[a b]", got)
+	}
+	// Unwrap返回最后一次尝试的错误
+	if !errors.Is(err, provider.ErrOverloaded) || errors.Is(err, provider.ErrServer) {
+		t.Errorf("errors.Is判断的是%v，期望只匹配最后一次尝试的ErrOverloaded", routeErr.Unwrap())
+	}
+	if (&RouteError{Model: "chat"}).Unwrap() != nil {
+		t.Error("没有尝试记录的RouteError Unwrap不为nil")
+	}
+}
+
+// collectStream 收集路由流式请求的事件
+func collectStream(t *testing.T, r *Router) ([]provider.StreamEvent, error) {
+	t.Helper()
+	var events []provider.StreamEvent
+	err := r.DoStream(context.Background(), chatRequest(), func(event provider.StreamEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+func TestRouterDoStreamFallback(t *testing.T) {
+	a := startUpstream(t, &testUpstream{status: 500, errBody: serverErrorBody})
+	b := startUpstream(t, &testUpstream{text: "b"})
+	r := newTestRouter(t, fallbackRoute(), map[string]*testUpstream{"a": a, "b": b})
+
+	events, err := collectStream(t, r)
+	if err != nil {
+		t.Fatalf("DoStream失败: %v", err)
+	}
+	if events[0].Type != provider.StreamEventStart {
+		t.Fatalf("第一个事件为%s，期望start", events[0].Type)
+	}
+	if got := attemptPlatforms(events[0].Attempts); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("开始事件的尝试记录为%v，期望[a b]", got)
+	}
+}
+
+// streamErrorChunk 流式响应中的服务端错误
+const streamErrorChunk = `{"error":{"message":"internal error","type":"server_error"}}`
+
+func TestRouterDoStreamNoFallbackAfterFirstEvent(t *testing.T) {
+	a := startUpstream(t, &testUpstream{chunks: []string{
+		`{"id":"chatcmpl-1","model":"m","choices":[{"index":0,"delta":{"role":"assistant","content":"a"}}]}`,
+		streamErrorChunk,
+	}})
+	b := startUpstream(t, &testUpstream{text: "b"})
+	r := newTestRouter(t, fallbackRoute(), map[string]*testUpstream{"a": a, "b": b})
+
+	events, err := collectStream(t, r)
+	var routeErr *RouteError
+	if err == nil || errors.As(err, &routeErr) || !errors.Is(err, provider.ErrServer) {
+		t.Fatalf("DoStream返回%v，期望原样返回已开始输出的目标的错误", err)
+	}
+	if calls := b.calls.Load(); calls != 0 {
+		t.Errorf("b收到%d个请求，期望开始输出后不回退", calls)
+	}
+	if last := events[len(events)-1]; last.Type != provider.StreamEventError {
+		t.Errorf("最后一个事件为%s，期望开始输出后的错误事件直接转发", last.Type)
+	}
+}
+
+func TestRouterDoStreamPendingErrorEvent(t *testing.T) {
+	t.Run("fallback_drops_error", func(t *testing.T) {
+		a := startUpstream(t, &testUpstream{chunks: []string{streamErrorChunk}})
+		b := startUpstream(t, &testUpstream{text: "b"})
+		r := newTestRouter(t, fallbackRoute(), map[string]*testUpstream{"a": a, "b": b})
+
+		events, err := collectStream(t, r)
+		if err != nil {
+			t.Fatalf("DoStream失败: %v", err)
+		}
+		for _, event := range events {
+			if event.Type == provider.StreamEventError {
+				t.Errorf("回退成功后仍收到a的错误事件: %v", event.Err)
+			}
+		}
+	})
+
+	t.Run("final_failure_replays_error", func(t *testing.T) {
+		a := startUpstream(t, &testUpstream{chunks: []string{streamErrorChunk}})
+		b := startUpstream(t, &testUpstream{chunks: []string{streamErrorChunk}})
+		r := newTestRouter(t, fallbackRoute(), map[string]*testUpstream{"a": a, "b": b})
+
+		events, err := collectStream(t, r)
+		var routeErr *RouteError
+		if !errors.As(err, &routeErr) || !errors.Is(err, provider.ErrServer) {
+			t.Fatalf("DoStream返回%v，期望包装ErrServer的RouteError", err)
+		}
+		if got := attemptPlatforms(routeErr.Attempts); !slices.Equal(got, []string{"a", "b"}) {
+			t.Errorf("尝试记录为%v，期望[a b]", got)
+		}
+		if len(events) != 1 || events[0].Type != provider.StreamEventError {
+			t.Fatalf("收到事件%v，期望只在最终失败时转发一次错误事件", events)
+		}
+	})
+}
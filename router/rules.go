@@ -0,0 +1,92 @@
+package router
+
+import (
+	"slices"
+
+	"github.com/cn-maul/Baize/domain"
+	"github.com/cn-maul/Baize/provider"
+)
+
+// selectModel 按配置中的路由规则选择请求的目标，没有规则匹配时使用请求的模型
+// 请求的模型为空时只能由规则决定目标
+func (r *Router) selectModel(req *provider.ChatRequest) string {
+	if len(r.config.Rules) == 0 {
+		return req.Model
+	}
+
+	facts := newRequestFacts(req)
+	for i, rule := range r.config.Rules {
+		if rule != nil && facts.match(rule.Match) {
+			r.logger.Debug("请求匹配路由规则 %s (#%d)，目标: %s", rule.Name, i+1, rule.Target)
+			return rule.Target
+		}
+	}
+	return req.Model
+}
+
+// requestFacts 规则匹配所需的请求属性，输入token数在需要时才估算
+type requestFacts struct {
+	req          *provider.ChatRequest
+	contentTypes map[string]bool
+	promptTokens int
+	estimated    bool
+}
+
+// newRequestFacts 收集请求中出现的内容类型
+func newRequestFacts(req *provider.ChatRequest) *requestFacts {
+	facts := &requestFacts{req: req, contentTypes: make(map[string]bool)}
+	for _, msg := range req.Messages {
+		if msg.Content != "" {
+			facts.contentTypes[domain.ContentTypeText] = true
+		}
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case provider.ContentPartText:
+				facts.contentTypes[domain.ContentTypeText] = true
+			case provider.ContentPartImage:
+				facts.contentTypes[domain.ContentTypeImage] = true
+			case provider.ContentPartDocument:
+				facts.contentTypes[domain.ContentTypeDocument] = true
+			}
+		}
+	}
+	return facts
+}
+
+// tokens 返回估算的输入token数
+func (f *requestFacts) tokens() int {
+	if !f.estimated {
+		f.promptTokens = provider.EstimatePromptTokens(f.req)
+		f.estimated = true
+	}
+	return f.promptTokens
+}
+
+// match 判断请求是否满足所有匹配条件
+func (f *requestFacts) match(m domain.RuleMatch) bool {
+	if len(m.Models) > 0 && !slices.Contains(m.Models, f.req.Model) {
+		return false
+	}
+	for _, contentType := range m.ContentTypes {
+		if !f.contentTypes[contentType] {
+			return false
+		}
+	}
+	for _, tag := range m.Tags {
+		if !slices.Contains(f.req.Tags, tag) {
+			return false
+		}
+	}
+	for key, value := range m.Metadata {
+		if v, ok := f.req.Metadata[key]; !ok || v != value {
+			return false
+		}
+	}
+	if m.MinPromptTokens > 0 && f.tokens() < m.MinPromptTokens {
+		return false
+	}
+	if m.MaxPromptTokens > 0 && f.tokens() > m.MaxPromptTokens {
+		return false
+	}
+	return true
+}
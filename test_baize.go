@@ -33,7 +33,7 @@ func main() {
 		fmt.Printf("  名称: %s\n", platform.Name)
 		fmt.Printf("  类型: %s\n", platform.Type)
 		fmt.Printf("  基础URL: %s\n", platform.BaseURL)
-		fmt.Printf("  可用模型: %v\n", platform.Models)
+		fmt.Printf("  可用模型: %v\n", platform.ModelNames())
 		fmt.Println()
 	}
 
@@ -63,7 +63,7 @@ func main() {
 	}
 
 	// 选择第一个模型进行测试
-	testModel := testPlatform.Models[0]
+	testModel := testPlatform.Models[0].Name
 	fmt.Printf("选择测试模型: %s\n\n", testModel)
 
 	ctx := context.Background()